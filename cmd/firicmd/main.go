@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/paper"
+	"github.com/esiqveland/firi/pkg/recorder"
+	"github.com/esiqveland/firi/pkg/store"
 )
 
 var firiApiUrl = getEnv("FIRI_API_URL", "https://api.firi.com")
-var apiKeyEnv = mustGetEnv("FIRI_API_KEY")
-var clientIdEnv = mustGetEnv("FIRI_CLIENT_ID")
-var secretKeyEnv = mustGetSecret("FIRI_SECRET_KEY")
+
+// paperBalance is the NOK balance paper trading starts with.
+const paperBalance = 100_000
 
 func main() {
 	err := runMain()
@@ -40,21 +50,66 @@ func runMain() error {
 	}
 
 	httpclient := &http.Client{Timeout: time.Second * 5}
-	signer := firiclient.NewSigner(
-		clientIdEnv,
-		apiKeyEnv,
-		secretKeyEnv,
-	)
 	publicClient := firiclient.New(
 		baseUrl,
 		httpclient.Do,
 	)
-	c := firiclient.NewAuthenticatedClient(
-		baseUrl,
-		signer,
-		publicClient,
-		httpclient.Do,
-	)
+
+	// record only needs the public API, so it runs without credentials
+	if len(os.Args) > 1 && os.Args[1] == "record" {
+		return runRecord(root, publicClient, os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		var checker firiclient.HealthChecker = publicClient
+		// only check signatures when credentials are configured
+		if os.Getenv("FIRI_API_KEY") != "" {
+			checker = firiclient.NewAuthenticatedClient(
+				baseUrl,
+				firiclient.NewSigner(
+					mustGetEnv("FIRI_CLIENT_ID"),
+					mustGetEnv("FIRI_API_KEY"),
+					mustGetSecret("FIRI_SECRET_KEY"),
+				),
+				publicClient,
+				httpclient.Do,
+			)
+		}
+		return runDoctor(root, checker, os.Args[2:])
+	}
+
+	// fail closed: a mistyped value must not fall through to live trading
+	paperTrading, err := strconv.ParseBool(getEnv("FIRI_PAPER_TRADING", "false"))
+	if err != nil {
+		return fmt.Errorf("invalid FIRI_PAPER_TRADING=%q: %w", os.Getenv("FIRI_PAPER_TRADING"), err)
+	}
+
+	var c firiclient.PrivateAPI
+	if paperTrading {
+		// real market data, simulated orders and balances
+		log.Printf("Paper trading with %v NOK", paperBalance)
+		c = paper.New(publicClient, paper.Config{
+			Balances: map[string]float64{"NOK": paperBalance},
+		})
+	} else {
+		signer := firiclient.NewSigner(
+			mustGetEnv("FIRI_CLIENT_ID"),
+			mustGetEnv("FIRI_API_KEY"),
+			mustGetSecret("FIRI_SECRET_KEY"),
+		)
+		c = firiclient.NewAuthenticatedClient(
+			baseUrl,
+			signer,
+			publicClient,
+			httpclient.Do,
+		)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		if paperTrading {
+			return errors.New("sync is not supported when paper trading, as it would store simulated orders and balances")
+		}
+		return runSync(root, c, os.Args[2:])
+	}
 
 	// marketsV1, err := c.GetMarketsV1(root)
 	// if err != nil {
@@ -119,6 +174,94 @@ func runMain() error {
 	return nil
 }
 
+func runSync(ctx context.Context, c store.Source, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	dbPath := fs.String("db", "firi.db", "path to local database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := db.Sync(ctx, c)
+	if err != nil {
+		return err
+	}
+	log.Printf("Synced to %v: new trades=%v new orders=%v new balances=%v", *dbPath, res.NewTrades, res.NewOrders, res.NewBalances)
+	return nil
+}
+
+func runDoctor(ctx context.Context, c firiclient.HealthChecker, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	listen := fs.String("listen", "", "serve the health report on this address instead of checking once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *listen != "" {
+		log.Printf("Serving health report on %v", *listen)
+		return http.ListenAndServe(*listen, firiclient.HealthHandler(c))
+	}
+
+	report := c.HealthCheck(ctx)
+	for _, check := range report.Checks {
+		status := "ok"
+		if !check.OK {
+			status = "FAIL: " + check.Error
+		}
+		fmt.Printf("%-12s %-10v %v\n", check.Name, check.Latency.Round(time.Millisecond), status)
+	}
+	fmt.Printf("clock skew: %v\n", report.ClockSkew)
+	if !report.Healthy {
+		return errors.New("unhealthy")
+	}
+	return nil
+}
+
+func runRecord(ctx context.Context, c firiclient.PublicAPI, args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	dir := fs.String("dir", "recordings", "directory to write recordings to")
+	markets := fs.String("markets", string(firiclient.BTCNOK), "comma separated markets to record")
+	interval := fs.Duration("interval", 10*time.Second, "poll interval")
+	maxBytes := fs.Int64("max-bytes", 64<<20, "rotate files after this many uncompressed bytes")
+	maxAge := fs.Duration("max-age", time.Hour, "rotate files after this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var marketIds []firiclient.MarketID
+	for _, m := range strings.Split(*markets, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			marketIds = append(marketIds, firiclient.MarketID(strings.ToUpper(m)))
+		}
+	}
+	w, err := recorder.NewWriter(recorder.WriterConfig{
+		Dir:      *dir,
+		MaxBytes: *maxBytes,
+		MaxAge:   *maxAge,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Recording markets=%v every %v to %v", marketIds, *interval, *dir)
+	r := recorder.New(c, w, recorder.Config{
+		Markets:  marketIds,
+		Interval: *interval,
+	})
+	err = r.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
 func mustParseUrl(uri string) *url.URL {
 	u, err := url.Parse(uri)
 	if err != nil {
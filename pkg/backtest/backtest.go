@@ -0,0 +1,177 @@
+// Package backtest replays recorded market data through a simulated exchange
+// that implements firiclient.PrivateAPI, so trading logic written against the
+// real client can be tested without risking money.
+package backtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+// Event is a point in recorded market data: an orderbook snapshot and/or the
+// market trades seen since the previous event.
+type Event struct {
+	Time      time.Time
+	Market    firiclient.MarketID
+	Orderbook *firiclient.Orderbook
+	Trades    firiclient.TradeHistory
+}
+
+// Source yields events in time order, returning io.EOF when exhausted.
+type Source interface {
+	Next() (Event, error)
+}
+
+type sliceSource struct {
+	events []Event
+}
+
+// SliceSource returns a Source replaying events.
+func SliceSource(events []Event) Source {
+	return &sliceSource{events: events}
+}
+
+func (s *sliceSource) Next() (Event, error) {
+	if len(s.events) == 0 {
+		return Event{}, io.EOF
+	}
+	ev := s.events[0]
+	s.events = s.events[1:]
+	return ev, nil
+}
+
+// Strategy is called after every event has been applied to the exchange, and
+// trades through api exactly as it would through the real client.
+type Strategy interface {
+	OnEvent(ctx context.Context, api firiclient.PrivateAPI, ev Event) error
+}
+
+type StrategyFunc func(ctx context.Context, api firiclient.PrivateAPI, ev Event) error
+
+func (f StrategyFunc) OnEvent(ctx context.Context, api firiclient.PrivateAPI, ev Event) error {
+	return f(ctx, api, ev)
+}
+
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+type Result struct {
+	StartEquity float64
+	EndEquity   float64
+	PnL         float64
+	// MaxDrawdown is the largest drop in NOK from a previous equity peak,
+	// and MaxDrawdownPct the largest drop relative to its peak.
+	MaxDrawdown    float64
+	MaxDrawdownPct float64
+	Equity         []EquityPoint
+
+	Orders     int
+	Cancelled  int
+	Fills      int
+	MakerFills int
+	TakerFills int
+	Volume     float64
+	FeesPaid   float64
+	Trades     firiclient.HistoricTrades
+	OpenOrders firiclient.ActiveOrders
+	Events     int
+	Start      time.Time
+	End        time.Time
+}
+
+type fillStats struct {
+	Orders     int
+	Cancelled  int
+	Fills      int
+	MakerFills int
+	TakerFills int
+	Volume     float64
+	FeesPaid   float64
+}
+
+func (s *fillStats) record(cost, fee float64, maker bool) {
+	s.Fills++
+	if maker {
+		s.MakerFills++
+	} else {
+		s.TakerFills++
+	}
+	s.Volume += cost
+	s.FeesPaid += fee
+}
+
+// Run replays src through ex, calling strategy after each event, and
+// reports PnL, drawdown and fill statistics. Equity is valued in NOK at mid price.
+func Run(ctx context.Context, ex *Exchange, src Source, strategy Strategy) (*Result, error) {
+	res := &Result{}
+	first := true
+	peak := 0.0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ev, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ex.Apply(ev)
+		if first {
+			res.Start = ev.Time
+			res.StartEquity = ex.Equity()
+			peak = res.StartEquity
+			first = false
+		}
+		if err := strategy.OnEvent(ctx, ex, ev); err != nil {
+			return nil, err
+		}
+		res.Events++
+		res.End = ev.Time
+
+		equity := ex.Equity()
+		res.Equity = append(res.Equity, EquityPoint{Time: ev.Time, Equity: equity})
+		if equity > peak {
+			peak = equity
+		}
+		dd := peak - equity
+		if dd > res.MaxDrawdown {
+			res.MaxDrawdown = dd
+		}
+		if peak > 0 && dd/peak > res.MaxDrawdownPct {
+			res.MaxDrawdownPct = dd / peak
+		}
+	}
+
+	res.EndEquity = ex.Equity()
+	res.PnL = res.EndEquity - res.StartEquity
+
+	ex.mu.Lock()
+	stats := ex.stats
+	ex.mu.Unlock()
+	res.Orders = stats.Orders
+	res.Cancelled = stats.Cancelled
+	res.Fills = stats.Fills
+	res.MakerFills = stats.MakerFills
+	res.TakerFills = stats.TakerFills
+	res.Volume = stats.Volume
+	res.FeesPaid = stats.FeesPaid
+
+	var err error
+	res.Trades, err = ex.GetAllTrades(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.OpenOrders, err = ex.GetActiveOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,114 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/fees"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func book(bid, ask, qty float64) *firiclient.Orderbook {
+	return &firiclient.Orderbook{
+		Bids: []firiclient.Order{{Price: bid, Quantity: qty}},
+		Asks: []firiclient.Order{{Price: ask, Quantity: qty}},
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestTakerAndMakerFills(t *testing.T) {
+	ex := NewExchange(RatesOf(fees.Rates{Maker: 0.001, Taker: 0.002}), map[string]float64{"NOK": 10_000})
+	ctx := context.Background()
+	ex.Apply(Event{Time: t0, Market: firiclient.BTCNOK, Orderbook: book(990, 1000, 5)})
+
+	// crosses the ask and fills as taker
+	_, err := ex.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 1000, Amount: 2})
+	if err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	if !almostEqual(ex.Balance("BTC"), 2) || !almostEqual(ex.Balance("NOK"), 10_000-2000-4) {
+		t.Errorf("unexpected balances BTC=%v NOK=%v", ex.Balance("BTC"), ex.Balance("NOK"))
+	}
+
+	// rests on the book until a market trade reaches it
+	_, err = ex.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Ask, Price: 1100, Amount: 2})
+	if err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	open, _ := ex.GetActiveOrders(ctx)
+	if len(open) != 1 {
+		t.Fatalf("expected 1 open order, got %v", len(open))
+	}
+	ex.Apply(Event{Time: t0.Add(time.Minute), Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+		{OrderType: firiclient.Bid, Price: 1100, Amount: 1.5, CreatedAt: t0.Add(time.Minute)},
+	}})
+	open, _ = ex.GetActiveOrders(ctx)
+	if len(open) != 1 || !almostEqual(open[0].Remaining, 0.5) {
+		t.Fatalf("expected partially filled order, got %+v", open)
+	}
+	trades, _ := ex.GetAllTrades(ctx)
+	if len(trades) != 2 || trades[0].IsMaker || !trades[1].IsMaker {
+		t.Errorf("unexpected trades=%+v", trades)
+	}
+
+	// selling more than available is rejected, as 1.5 BTC is on hold
+	_, err = ex.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Ask, Price: 1200, Amount: 1})
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
+
+func TestRunReportsPnLAndDrawdown(t *testing.T) {
+	ex := NewExchange(FeeRates{}, map[string]float64{"NOK": 1000})
+	events := []Event{
+		{Time: t0, Market: firiclient.BTCNOK, Orderbook: book(99, 100, 10)},
+		{Time: t0.Add(time.Minute), Market: firiclient.BTCNOK, Orderbook: book(79, 81, 10)},
+		{Time: t0.Add(2 * time.Minute), Market: firiclient.BTCNOK, Orderbook: book(119, 121, 10)},
+	}
+	bought := false
+	strategy := StrategyFunc(func(ctx context.Context, api firiclient.PrivateAPI, ev Event) error {
+		if bought {
+			return nil
+		}
+		bought = true
+		_, err := api.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 100, Amount: 10})
+		return err
+	})
+
+	res, err := Run(context.Background(), ex, SliceSource(events), strategy)
+	if err != nil {
+		t.Fatalf("error running backtest: %v", err)
+	}
+	// bought 10 at 100, marked at 99.5, then 80, then 120
+	if !almostEqual(res.PnL, 200) {
+		t.Errorf("unexpected pnl=%v", res.PnL)
+	}
+	if !almostEqual(res.MaxDrawdown, 200) {
+		t.Errorf("unexpected max drawdown=%v", res.MaxDrawdown)
+	}
+	if res.Fills != 1 || res.TakerFills != 1 || res.Events != 3 {
+		t.Errorf("unexpected stats=%+v", res)
+	}
+}
+
+func TestLastPriceIsLatestTrade(t *testing.T) {
+	ctx := context.Background()
+	ex := NewExchange(FeeRates{}, map[string]float64{"NOK": 1000})
+	// newest first, as Firi lists trades
+	ex.Apply(Event{Time: t0, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+		{OrderType: firiclient.Bid, Price: 1100, Amount: 1, CreatedAt: t0},
+		{OrderType: firiclient.Bid, Price: 1000, Amount: 1, CreatedAt: t0.Add(-time.Minute)},
+	}})
+	markets, _ := ex.GetMarketsV2(ctx)
+	if len(markets) != 1 || markets[0].Last != 1100 {
+		t.Errorf("expected last price of the latest trade, got %+v", markets)
+	}
+}
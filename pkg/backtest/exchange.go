@@ -0,0 +1,531 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/fees"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+const quoteCurrency = "NOK"
+
+// epsilon is the amount below which an order is considered fully matched.
+const epsilon = 1e-12
+
+var (
+	ErrInsufficientFunds = errors.New("backtest: insufficient funds")
+	ErrUnknownMarket     = errors.New("backtest: unknown market")
+	ErrInvalidOrder      = errors.New("backtest: invalid order")
+	ErrNotSupported      = errors.New("backtest: not supported")
+	ErrUnknownOrder      = errors.New("backtest: unknown or closed order")
+)
+
+// FeeRates are the maker and taker fees as a fraction of the traded cost.
+type FeeRates struct {
+	Maker float64
+	Taker float64
+}
+
+// RatesOf returns the rates of a fee schedule tier for the simulated exchange.
+func RatesOf(r fees.Rates) FeeRates {
+	return FeeRates{Maker: r.Maker, Taker: r.Taker}
+}
+
+// Exchange is a simulated Firi exchange implementing firiclient.PrivateAPI.
+// Orders are matched against the latest orderbook snapshot when placed, and
+// resting orders are filled by later market trades crossing their price.
+type Exchange struct {
+	mu sync.Mutex
+
+	fees   FeeRates
+	now    time.Time
+	nextId int64
+	// tradeSeq numbers own trades, as trade ids are strings in the API
+	tradeSeq int64
+
+	books map[firiclient.MarketID]*firiclient.Orderbook
+	// liquidity is what remains of the latest snapshot after own taker fills
+	liquidity map[firiclient.MarketID]*firiclient.Orderbook
+	history   map[firiclient.MarketID]firiclient.TradeHistory
+	last      map[firiclient.MarketID]float64
+
+	balance map[string]float64
+	hold    map[string]float64
+
+	open   map[int64]*firiclient.ActiveOrder
+	closed firiclient.ActiveOrders
+	trades firiclient.HistoricTrades
+
+	stats fillStats
+}
+
+var _ firiclient.PrivateAPI = (*Exchange)(nil)
+
+// NewExchange creates a simulated exchange with the given starting balances, e.g. {"NOK": 100000}.
+func NewExchange(fees FeeRates, balances map[string]float64) *Exchange {
+	b := map[string]float64{}
+	for k, v := range balances {
+		b[k] = v
+	}
+	return &Exchange{
+		fees:      fees,
+		nextId:    1,
+		books:     map[firiclient.MarketID]*firiclient.Orderbook{},
+		liquidity: map[firiclient.MarketID]*firiclient.Orderbook{},
+		history:   map[firiclient.MarketID]firiclient.TradeHistory{},
+		last:      map[firiclient.MarketID]float64{},
+		balance:   b,
+		hold:      map[string]float64{},
+		open:      map[int64]*firiclient.ActiveOrder{},
+	}
+}
+
+// maxHistory is the number of market trades kept per market for GetMarketTradeHistoryV2.
+const maxHistory = 500
+
+// Apply advances the exchange clock to the event, replaces the orderbook if the
+// event carries one, and fills resting orders crossed by the event's trades.
+func (e *Exchange) Apply(ev Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if ev.Time.After(e.now) {
+		e.now = ev.Time
+	}
+	if ev.Orderbook != nil {
+		e.books[ev.Market] = copyBook(ev.Orderbook)
+		e.liquidity[ev.Market] = copyBook(ev.Orderbook)
+	}
+	for _, t := range ev.Trades {
+		e.matchResting(ev.Market, t)
+	}
+	if len(ev.Trades) > 0 {
+		// the trades may come in any order, so the last price is that of the latest
+		latest := ev.Trades[0]
+		for _, t := range ev.Trades[1:] {
+			if t.CreatedAt.After(latest.CreatedAt) {
+				latest = t
+			}
+		}
+		e.last[ev.Market] = latest.Price
+		h := append(e.history[ev.Market], ev.Trades...)
+		if len(h) > maxHistory {
+			h = h[len(h)-maxHistory:]
+		}
+		e.history[ev.Market] = h
+	}
+}
+
+// Now returns the simulated time.
+func (e *Exchange) Now() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.now
+}
+
+// Balance returns the total balance of a currency, including what is on hold.
+func (e *Exchange) Balance(currency string) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.balance[currency]
+}
+
+// Equity values all balances in NOK at the mid price of their markets.
+func (e *Exchange) Equity() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.equity()
+}
+
+func (e *Exchange) equity() float64 {
+	total := e.balance[quoteCurrency]
+	for currency, amount := range e.balance {
+		if currency == quoteCurrency || amount == 0 {
+			continue
+		}
+		total += amount * e.markPrice(firiclient.MarketID(currency+quoteCurrency))
+	}
+	return total
+}
+
+func (e *Exchange) markPrice(market firiclient.MarketID) float64 {
+	if b, ok := e.books[market]; ok && len(b.Bids) > 0 && len(b.Asks) > 0 {
+		return (b.Bids[0].Price + b.Asks[0].Price) / 2
+	}
+	return e.last[market]
+}
+
+func splitMarket(market string) (base string, quote string, err error) {
+	if !strings.HasSuffix(market, quoteCurrency) || len(market) <= len(quoteCurrency) {
+		return "", "", fmt.Errorf("%w: %v", ErrUnknownMarket, market)
+	}
+	return strings.TrimSuffix(market, quoteCurrency), quoteCurrency, nil
+}
+
+func (e *Exchange) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	base, quote, err := splitMarket(r.Market)
+	if err != nil {
+		return nil, err
+	}
+	if r.Price <= 0 || r.Amount <= 0 || (r.Type != firiclient.Bid && r.Type != firiclient.Ask) {
+		return nil, fmt.Errorf("%w: %+v", ErrInvalidOrder, *r)
+	}
+	switch r.Type {
+	case firiclient.Bid:
+		need := r.Price * r.Amount * (1 + e.fees.Taker)
+		if e.available(quote) < need-epsilon {
+			return nil, fmt.Errorf("%w: need %v %v, available %v", ErrInsufficientFunds, need, quote, e.available(quote))
+		}
+		e.hold[quote] += need
+	case firiclient.Ask:
+		if e.available(base) < r.Amount-epsilon {
+			return nil, fmt.Errorf("%w: need %v %v, available %v", ErrInsufficientFunds, r.Amount, base, e.available(base))
+		}
+		e.hold[base] += r.Amount
+	}
+
+	o := &firiclient.ActiveOrder{
+		Id:        e.nextId,
+		Market:    r.Market,
+		Type:      r.Type,
+		Price:     r.Price,
+		Amount:    r.Amount,
+		Remaining: r.Amount,
+		CreatedAt: e.now,
+	}
+	e.nextId++
+	e.stats.Orders++
+	e.matchTaker(o)
+	if o.Remaining > epsilon {
+		e.open[o.Id] = o
+	} else {
+		e.closed = append(e.closed, *o)
+	}
+	return &firiclient.CreateOrderResponse{Id: o.Id}, nil
+}
+
+func (e *Exchange) available(currency string) float64 {
+	return e.balance[currency] - e.hold[currency]
+}
+
+// matchTaker fills o against the opposite side of the current book snapshot,
+// consuming its liquidity until the next snapshot arrives.
+func (e *Exchange) matchTaker(o *firiclient.ActiveOrder) {
+	book, ok := e.liquidity[firiclient.MarketID(o.Market)]
+	if !ok {
+		return
+	}
+	levels := &book.Asks
+	crosses := func(p float64) bool { return p <= o.Price }
+	if o.Type == firiclient.Ask {
+		levels = &book.Bids
+		crosses = func(p float64) bool { return p >= o.Price }
+	}
+	for len(*levels) > 0 && o.Remaining > epsilon {
+		level := &(*levels)[0]
+		if !crosses(level.Price) {
+			break
+		}
+		q := math.Min(level.Quantity, o.Remaining)
+		e.fill(o, level.Price, q, false)
+		level.Quantity -= q
+		if level.Quantity <= epsilon {
+			*levels = (*levels)[1:]
+		}
+	}
+}
+
+// matchResting fills open orders in market crossed by a market trade, best priced first.
+func (e *Exchange) matchResting(market firiclient.MarketID, t firiclient.HistoricOrder) {
+	var crossed []*firiclient.ActiveOrder
+	for _, o := range e.open {
+		if o.Market != string(market) {
+			continue
+		}
+		if (o.Type == firiclient.Bid && t.Price <= o.Price) || (o.Type == firiclient.Ask && t.Price >= o.Price) {
+			crossed = append(crossed, o)
+		}
+	}
+	sort.Slice(crossed, func(i, j int) bool {
+		a, b := crossed[i], crossed[j]
+		if a.Price != b.Price {
+			if a.Type == firiclient.Bid {
+				return a.Price > b.Price
+			}
+			return a.Price < b.Price
+		}
+		return a.Id < b.Id
+	})
+	liquidity := t.Amount
+	for _, o := range crossed {
+		if liquidity <= epsilon {
+			break
+		}
+		q := math.Min(liquidity, o.Remaining)
+		e.fill(o, o.Price, q, true)
+		liquidity -= q
+		if o.Remaining <= epsilon {
+			delete(e.open, o.Id)
+			e.closed = append(e.closed, *o)
+		}
+	}
+}
+
+func (e *Exchange) fill(o *firiclient.ActiveOrder, price float64, q float64, maker bool) {
+	base, quote, _ := splitMarket(o.Market)
+	rate := e.fees.Taker
+	if maker {
+		rate = e.fees.Maker
+	}
+	cost := price * q
+	fee := cost * rate
+	switch o.Type {
+	case firiclient.Bid:
+		e.hold[quote] -= o.Price * q * (1 + e.fees.Taker)
+		e.balance[quote] -= cost + fee
+		e.balance[base] += q
+	case firiclient.Ask:
+		e.hold[base] -= q
+		e.balance[base] -= q
+		e.balance[quote] += cost - fee
+	}
+	o.Remaining -= q
+	o.Matched += q
+
+	e.tradeSeq++
+	e.trades = append(e.trades, firiclient.HistoricTrade{
+		Id:             strconv.FormatInt(e.tradeSeq, 10),
+		Market:         o.Market,
+		Price:          price,
+		PriceCurrency:  quote,
+		Amount:         q,
+		AmountCurrency: base,
+		Cost:           cost,
+		CostCurrency:   quote,
+		Side:           string(o.Type),
+		IsMaker:        maker,
+		Date:           e.now,
+	})
+	e.stats.record(cost, fee, maker)
+}
+
+func (e *Exchange) cancel(o *firiclient.ActiveOrder) {
+	base, quote, _ := splitMarket(o.Market)
+	switch o.Type {
+	case firiclient.Bid:
+		e.hold[quote] -= o.Price * o.Remaining * (1 + e.fees.Taker)
+	case firiclient.Ask:
+		e.hold[base] -= o.Remaining
+	}
+	o.Cancelled = o.Remaining
+	o.Remaining = 0
+	delete(e.open, o.Id)
+	e.closed = append(e.closed, *o)
+	e.stats.Cancelled++
+}
+
+func (e *Exchange) DeleteAllOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := firiclient.ActiveOrders{}
+	for _, o := range e.sortedOpen("") {
+		e.cancel(o)
+		res = append(res, *o)
+	}
+	return res, nil
+}
+
+func (e *Exchange) CancelOrder(ctx context.Context, orderId int64, marketId firiclient.MarketID) (*firiclient.ActiveOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.open[orderId]
+	if !ok || o.Market != string(marketId) {
+		return nil, fmt.Errorf("%w: %v in %v", ErrUnknownOrder, orderId, marketId)
+	}
+	e.cancel(o)
+	res := *o
+	return &res, nil
+}
+
+func (e *Exchange) sortedOpen(market firiclient.MarketID) []*firiclient.ActiveOrder {
+	res := make([]*firiclient.ActiveOrder, 0, len(e.open))
+	for _, o := range e.open {
+		if market == "" || o.Market == string(market) {
+			res = append(res, o)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+func (e *Exchange) GetActiveOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := firiclient.ActiveOrders{}
+	for _, o := range e.sortedOpen("") {
+		res = append(res, *o)
+	}
+	return res, nil
+}
+
+func (e *Exchange) GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := firiclient.ActiveOrders{}
+	for _, o := range e.sortedOpen(marketId) {
+		res = append(res, *o)
+	}
+	return res, nil
+}
+
+func (e *Exchange) GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make(firiclient.ActiveOrders, len(e.closed))
+	copy(res, e.closed)
+	return res, nil
+}
+
+func (e *Exchange) GetAllTrades(ctx context.Context) (firiclient.HistoricTrades, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make(firiclient.HistoricTrades, len(e.trades))
+	copy(res, e.trades)
+	return res, nil
+}
+
+func (e *Exchange) GetBalancesV2(ctx context.Context) (firiclient.Balances, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := firiclient.Balances{}
+	for currency, amount := range e.balance {
+		res = append(res, firiclient.Balance{
+			Currency:  currency,
+			Balance:   amount,
+			Hold:      e.hold[currency],
+			Available: amount - e.hold[currency],
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Currency < res[j].Currency
+	})
+	return res, nil
+}
+
+func (e *Exchange) PostWithdrawal(ctx context.Context, coinId string, r *firiclient.CreateWithdrawalRequest) (*firiclient.CreateWithdrawalResponse, error) {
+	return nil, fmt.Errorf("%w: withdrawals", ErrNotSupported)
+}
+
+// GetServerTime returns the simulated time.
+func (e *Exchange) GetServerTime(ctx context.Context) (time.Time, error) {
+	return e.Now(), nil
+}
+
+func (e *Exchange) GetMarketsV1(ctx context.Context) (firiclient.Markets, error) {
+	return e.GetMarketsV2(ctx)
+}
+
+func (e *Exchange) GetMarketsV2(ctx context.Context) (firiclient.Markets, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := firiclient.Markets{}
+	for market, last := range e.last {
+		res = append(res, firiclient.Market{ID: string(market), Last: last})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (e *Exchange) GetMarketTickersV2(ctx context.Context) (firiclient.MarketTickers, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := firiclient.MarketTickers{}
+	for market := range e.books {
+		res = append(res, e.ticker(market))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].MarketID < res[j].MarketID
+	})
+	return res, nil
+}
+
+func (e *Exchange) GetMarketTickerV2(ctx context.Context, marketId firiclient.MarketID) (*firiclient.MarketTicker, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.books[marketId]; !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownMarket, marketId)
+	}
+	t := e.ticker(marketId)
+	return &t, nil
+}
+
+func (e *Exchange) ticker(market firiclient.MarketID) firiclient.MarketTicker {
+	t := firiclient.MarketTicker{MarketID: string(market)}
+	b := e.books[market]
+	if len(b.Bids) > 0 {
+		t.Bid = b.Bids[0].Price
+	}
+	if len(b.Asks) > 0 {
+		t.Ask = b.Asks[0].Price
+	}
+	if t.Bid > 0 && t.Ask > 0 {
+		t.Spread = t.Ask - t.Bid
+	}
+	return t
+}
+
+func (e *Exchange) GetMarketTradeHistoryV2(ctx context.Context, marketId firiclient.MarketID) (firiclient.TradeHistory, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h := e.history[marketId]
+	res := make(firiclient.TradeHistory, len(h))
+	copy(res, h)
+	return res, nil
+}
+
+func (e *Exchange) GetOrderbookV2(ctx context.Context, marketId firiclient.MarketID) (*firiclient.Orderbook, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, ok := e.books[marketId]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownMarket, marketId)
+	}
+	return copyBook(b), nil
+}
+
+func copyBook(b *firiclient.Orderbook) *firiclient.Orderbook {
+	res := &firiclient.Orderbook{
+		Bids: make([]firiclient.Order, len(b.Bids)),
+		Asks: make([]firiclient.Order, len(b.Asks)),
+	}
+	copy(res.Bids, b.Bids)
+	copy(res.Asks, b.Asks)
+	return res
+}
@@ -0,0 +1,30 @@
+package backtest
+
+import (
+	"github.com/esiqveland/firi/pkg/recorder"
+)
+
+type recordingSource struct {
+	r *recorder.Reader
+}
+
+// RecordingSource replays market data captured by the recorder. Ticker
+// records carry no per-market state and are skipped.
+func RecordingSource(r *recorder.Reader) Source {
+	return &recordingSource{r: r}
+}
+
+func (s *recordingSource) Next() (Event, error) {
+	for {
+		rec, err := s.r.Next()
+		if err != nil {
+			return Event{}, err
+		}
+		switch rec.Kind {
+		case recorder.KindOrderbook:
+			return Event{Time: rec.Time, Market: rec.Market, Orderbook: rec.Orderbook}, nil
+		case recorder.KindTrades:
+			return Event{Time: rec.Time, Market: rec.Market, Trades: rec.Trades}, nil
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package candles aggregates public trade history into OHLCV candles.
+package candles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/recorder"
+)
+
+// Intervals are the supported candle intervals.
+var Intervals = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	4 * time.Hour,
+	24 * time.Hour,
+}
+
+func validInterval(d time.Duration) bool {
+	for _, i := range Intervals {
+		if i == d {
+			return true
+		}
+	}
+	return false
+}
+
+type Candle struct {
+	Start        time.Time `json:"start"`
+	Open         float64   `json:"open"`
+	High         float64   `json:"high"`
+	Low          float64   `json:"low"`
+	Close        float64   `json:"close"`
+	Volume       float64   `json:"volume"`
+	QuoteVolume  float64   `json:"quote_volume"`
+	Trades       int       `json:"trades"`
+	FirstTradeAt time.Time `json:"first_trade_at"`
+	LastTradeAt  time.Time `json:"last_trade_at"`
+	// LastTrades are the trades at LastTradeAt, so trades sharing that time
+	// can be told apart from them after a restart.
+	LastTrades []TradeID `json:"last_trades,omitempty"`
+}
+
+// TradeID identifies a trade at a known time, as the public history has no
+// trade ids.
+type TradeID struct {
+	Type   firiclient.OrderType `json:"type"`
+	Price  float64              `json:"price"`
+	Amount float64              `json:"amount"`
+}
+
+func (c *Candle) add(t firiclient.HistoricOrder) {
+	if c.Trades == 0 {
+		c.Open, c.High, c.Low, c.Close = t.Price, t.Price, t.Price, t.Price
+		c.FirstTradeAt, c.LastTradeAt = t.CreatedAt, t.CreatedAt
+	}
+	if t.Price > c.High {
+		c.High = t.Price
+	}
+	if t.Price < c.Low {
+		c.Low = t.Price
+	}
+	if t.CreatedAt.Before(c.FirstTradeAt) {
+		c.FirstTradeAt = t.CreatedAt
+		c.Open = t.Price
+	}
+	id := TradeID{Type: t.OrderType, Price: t.Price, Amount: t.Amount}
+	switch {
+	case c.Trades == 0 || t.CreatedAt.After(c.LastTradeAt):
+		c.LastTradeAt = t.CreatedAt
+		c.Close = t.Price
+		c.LastTrades = []TradeID{id}
+	case t.CreatedAt.Equal(c.LastTradeAt):
+		c.Close = t.Price
+		c.LastTrades = append(c.LastTrades, id)
+	}
+	c.Volume += t.Amount
+	c.QuoteVolume += t.Total
+	c.Trades++
+}
+
+// tradeKey identifies a trade, as the public history has no trade ids.
+type tradeKey struct {
+	at int64
+	TradeID
+}
+
+func keyOf(t firiclient.HistoricOrder) tradeKey {
+	return tradeKey{at: t.CreatedAt.UnixNano(), TradeID: TradeID{Type: t.OrderType, Price: t.Price, Amount: t.Amount}}
+}
+
+// Builder aggregates trades into candles of one interval. Trades may arrive
+// out of order and repeatedly, as when polling overlapping history windows.
+type Builder struct {
+	interval  time.Duration
+	candles   map[int64]*Candle
+	seen      map[int64]map[tradeKey]struct{}
+	watermark time.Time
+	// atWatermark drops trades at the watermark too, for candles stored
+	// without their LastTrades.
+	atWatermark bool
+}
+
+func NewBuilder(interval time.Duration) (*Builder, error) {
+	if !validInterval(interval) {
+		return nil, fmt.Errorf("candles: unsupported interval=%v", interval)
+	}
+	return &Builder{
+		interval: interval,
+		candles:  map[int64]*Candle{},
+		seen:     map[int64]map[tradeKey]struct{}{},
+	}, nil
+}
+
+func (b *Builder) Interval() time.Duration {
+	return b.interval
+}
+
+// Load seeds the builder with previously built candles. Trades before the
+// last trade of the loaded candles, and the trades at its time that are
+// already counted, are ignored by later calls to Add.
+func (b *Builder) Load(candles []Candle) {
+	var last *Candle
+	for i := range candles {
+		c := candles[i]
+		b.candles[c.Start.Unix()] = &c
+		if c.LastTradeAt.After(b.watermark) {
+			b.watermark = c.LastTradeAt
+			last = &c
+		}
+	}
+	if last == nil {
+		return
+	}
+	b.atWatermark = len(last.LastTrades) == 0
+	slot := b.watermark.Truncate(b.interval).Unix()
+	seen, ok := b.seen[slot]
+	if !ok {
+		seen = map[tradeKey]struct{}{}
+		b.seen[slot] = seen
+	}
+	for _, id := range last.LastTrades {
+		seen[tradeKey{at: b.watermark.UnixNano(), TradeID: id}] = struct{}{}
+	}
+}
+
+// Add adds trades and returns the candles that changed, ordered by start.
+func (b *Builder) Add(trades ...firiclient.HistoricOrder) []Candle {
+	changed := map[int64]struct{}{}
+	for _, t := range trades {
+		if t.CreatedAt.Before(b.watermark) || (b.atWatermark && t.CreatedAt.Equal(b.watermark)) {
+			continue
+		}
+		start := t.CreatedAt.Truncate(b.interval)
+		slot := start.Unix()
+		key := keyOf(t)
+		seen, ok := b.seen[slot]
+		if !ok {
+			seen = map[tradeKey]struct{}{}
+			b.seen[slot] = seen
+		}
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		c, ok := b.candles[slot]
+		if !ok {
+			c = &Candle{Start: start.UTC()}
+			b.candles[slot] = c
+		}
+		c.add(t)
+		changed[slot] = struct{}{}
+	}
+	res := make([]Candle, 0, len(changed))
+	for slot := range changed {
+		res = append(res, *b.candles[slot])
+	}
+	sortCandles(res)
+	return res
+}
+
+// Candles returns all candles ordered by start.
+func (b *Builder) Candles() []Candle {
+	res := make([]Candle, 0, len(b.candles))
+	for _, c := range b.candles {
+		res = append(res, *c)
+	}
+	sortCandles(res)
+	return res
+}
+
+// Prune forgets candles and deduplication state starting before t.
+func (b *Builder) Prune(before time.Time) {
+	for slot, c := range b.candles {
+		if c.Start.Before(before) {
+			delete(b.candles, slot)
+		}
+	}
+	for slot := range b.seen {
+		if time.Unix(slot, 0).Before(before) {
+			delete(b.seen, slot)
+		}
+	}
+}
+
+func sortCandles(c []Candle) {
+	sort.Slice(c, func(i, j int) bool {
+		return c[i].Start.Before(c[j].Start)
+	})
+}
+
+// HistorySource is the part of the public client used to fetch trades.
+type HistorySource interface {
+	GetMarketTradeHistoryV2(ctx context.Context, marketId firiclient.MarketID) (firiclient.TradeHistory, error)
+}
+
+// Store persists candles per market and interval.
+type Store interface {
+	PutCandles(market firiclient.MarketID, interval time.Duration, candles []Candle) error
+	Candles(market firiclient.MarketID, interval time.Duration) ([]Candle, error)
+}
+
+// Series keeps the candles of one market and interval up to date from the
+// trade history, persisting every changed candle to a Store.
+type Series struct {
+	Market  firiclient.MarketID
+	builder *Builder
+	store   Store
+}
+
+// NewSeries creates a series with the candles already in store.
+func NewSeries(market firiclient.MarketID, interval time.Duration, store Store) (*Series, error) {
+	b, err := NewBuilder(interval)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := store.Candles(market, interval)
+	if err != nil {
+		return nil, err
+	}
+	b.Load(existing)
+	return &Series{
+		Market:  market,
+		builder: b,
+		store:   store,
+	}, nil
+}
+
+// Update fetches the latest trades, aggregates them and persists the changed candles.
+func (s *Series) Update(ctx context.Context, src HistorySource) ([]Candle, error) {
+	history, err := src.GetMarketTradeHistoryV2(ctx, s.Market)
+	if err != nil {
+		return nil, err
+	}
+	return s.Add(history...)
+}
+
+// Add aggregates trades, e.g. from a recorded history, and persists the changed candles.
+func (s *Series) Add(trades ...firiclient.HistoricOrder) ([]Candle, error) {
+	changed := s.builder.Add(trades...)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	err := s.store.PutCandles(s.Market, s.builder.Interval(), changed)
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// Backfill adds the trades of the series' market recorded by a recorder, which
+// reach further back than the window of the trade history. Trades before the
+// newest trade already aggregated are skipped, so backfill before updating
+// from the API. It returns the number of candles changed.
+func (s *Series) Backfill(r *recorder.Reader) (int, error) {
+	changed := map[int64]struct{}{}
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return len(changed), nil
+		}
+		if err != nil {
+			return len(changed), err
+		}
+		if rec.Kind != recorder.KindTrades || rec.Market != s.Market {
+			continue
+		}
+		cs, err := s.Add(rec.Trades...)
+		if err != nil {
+			return len(changed), err
+		}
+		for _, c := range cs {
+			changed[c.Start.Unix()] = struct{}{}
+		}
+	}
+}
+
+func (s *Series) Candles() []Candle {
+	return s.builder.Candles()
+}
@@ -0,0 +1,121 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/recorder"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func tr(offset time.Duration, price, amount float64) firiclient.HistoricOrder {
+	return firiclient.HistoricOrder{
+		OrderType: firiclient.Bid,
+		Price:     price,
+		Amount:    amount,
+		Total:     price * amount,
+		CreatedAt: t0.Add(offset),
+	}
+}
+
+func TestBuilderAggregatesOutOfOrderAndDuplicates(t *testing.T) {
+	b, err := NewBuilder(time.Minute)
+	if err != nil {
+		t.Fatalf("error creating builder: %v", err)
+	}
+	b.Add(
+		tr(30*time.Second, 110, 1),
+		tr(10*time.Second, 100, 1),
+		tr(70*time.Second, 120, 2),
+	)
+	// overlapping poll: the first trade again, plus a late one for the first minute
+	changed := b.Add(
+		tr(30*time.Second, 110, 1),
+		tr(50*time.Second, 90, 0.5),
+	)
+	if len(changed) != 1 {
+		t.Fatalf("expected 1 changed candle, got %v", len(changed))
+	}
+
+	cs := b.Candles()
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 candles, got %v", len(cs))
+	}
+	first := cs[0]
+	if first.Open != 100 || first.High != 110 || first.Low != 90 || first.Close != 90 {
+		t.Errorf("unexpected OHLC=%+v", first)
+	}
+	if first.Volume != 2.5 || first.Trades != 3 {
+		t.Errorf("unexpected volume=%v trades=%v", first.Volume, first.Trades)
+	}
+	if !cs[1].Start.Equal(t0.Add(time.Minute)) || cs[1].Close != 120 {
+		t.Errorf("unexpected second candle=%+v", cs[1])
+	}
+}
+
+func TestLoadIgnoresAlreadyAggregatedTrades(t *testing.T) {
+	b, _ := NewBuilder(time.Minute)
+	b.Add(tr(10*time.Second, 100, 1))
+
+	restarted, _ := NewBuilder(time.Minute)
+	restarted.Load(b.Candles())
+	restarted.Add(tr(10*time.Second, 100, 1), tr(20*time.Second, 105, 1))
+
+	cs := restarted.Candles()
+	if len(cs) != 1 || cs[0].Trades != 2 || cs[0].Close != 105 {
+		t.Errorf("unexpected candles after restart=%+v", cs)
+	}
+}
+
+func TestLoadKeepsNewTradesAtWatermark(t *testing.T) {
+	b, _ := NewBuilder(time.Minute)
+	b.Add(tr(10*time.Second, 100, 1))
+
+	// a second trade at the same time shows up after a restart
+	restarted, _ := NewBuilder(time.Minute)
+	restarted.Load(b.Candles())
+	restarted.Add(tr(10*time.Second, 100, 1), tr(10*time.Second, 101, 2))
+
+	cs := restarted.Candles()
+	if len(cs) != 1 || cs[0].Trades != 2 || cs[0].Volume != 3 {
+		t.Errorf("expected the new trade at the watermark to be added once, got %+v", cs)
+	}
+}
+
+type memStore map[time.Duration][]Candle
+
+func (m memStore) PutCandles(market firiclient.MarketID, interval time.Duration, candles []Candle) error {
+	m[interval] = append(m[interval], candles...)
+	return nil
+}
+
+func (m memStore) Candles(market firiclient.MarketID, interval time.Duration) ([]Candle, error) {
+	return nil, nil
+}
+
+func TestBackfillFromRecording(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := recorder.NewWriter(recorder.WriterConfig{Dir: dir})
+	w.Write(&recorder.Record{Kind: recorder.KindTrades, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{tr(0, 100, 1), tr(time.Minute, 105, 1)}})
+	w.Write(&recorder.Record{Kind: recorder.KindTrades, Market: firiclient.ETHNOK, Trades: firiclient.TradeHistory{tr(0, 10, 1)}})
+	w.Close()
+
+	s, _ := NewSeries(firiclient.BTCNOK, time.Minute, memStore{})
+	r, _ := recorder.OpenReader(dir)
+	defer r.Close()
+	n, err := s.Backfill(r)
+	if err != nil {
+		t.Fatalf("error backfilling: %v", err)
+	}
+	if cs := s.Candles(); n != 2 || len(cs) != 2 || cs[0].Close != 100 || cs[1].Close != 105 {
+		t.Errorf("expected 2 BTCNOK candles, got n=%v %+v", n, cs)
+	}
+}
+
+func TestUnsupportedInterval(t *testing.T) {
+	if _, err := NewBuilder(7 * time.Minute); err == nil {
+		t.Errorf("expected error for unsupported interval")
+	}
+}
@@ -0,0 +1,227 @@
+// Package cassette records real interactions with the Firi API to files, and
+// replays them deterministically as a firiclient.Doer for golden tests.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var ErrNoInteraction = errors.New("cassette: no recorded interaction matches request")
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("cassette: error parsing %v: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder passes requests through to a real Doer and records them, with
+// secrets scrubbed by a redaction policy.
+type Recorder struct {
+	mu       sync.Mutex
+	next     firiclient.Doer
+	policy   *firiclient.RedactionPolicy
+	cassette *Cassette
+}
+
+// NewRecorder records interactions made through next. If policy is nil, the
+// default redaction policy is used. Add the api key to the policy with
+// AddSecret to scrub it from recorded bodies.
+func NewRecorder(next firiclient.Doer, policy *firiclient.RedactionPolicy) *Recorder {
+	if policy == nil {
+		policy = firiclient.NewRedactionPolicy()
+	}
+	return &Recorder{
+		next:     next,
+		policy:   policy,
+		cassette: &Cassette{},
+	}
+}
+
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.next(req)
+	if err != nil {
+		return res, err
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.policy.URL(req.URL),
+			Header: r.policy.Header(req.Header),
+			Body:   r.policy.String(string(reqBody)),
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     r.policy.Header(res.Header),
+			Body:       r.policy.String(string(resBody)),
+		},
+	})
+	return res, nil
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := &Cassette{Interactions: make([]Interaction, len(r.cassette.Interactions))}
+	copy(cp.Interactions, r.cassette.Interactions)
+	return cp
+}
+
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Replayer serves recorded responses. A request matches an interaction on
+// method, path, query parameters and body, after redacting it with the policy
+// the interaction was recorded with, so signature parameters that differ on
+// every call match their redacted recording.
+// Each interaction is served once, in recorded order, so repeated calls to
+// the same endpoint replay the same sequence of responses as recorded.
+type Replayer struct {
+	mu     sync.Mutex
+	c      *Cassette
+	policy *firiclient.RedactionPolicy
+	used   []bool
+}
+
+// NewReplayer replays c, which was recorded with policy. If policy is nil,
+// the default redaction policy is used.
+func NewReplayer(c *Cassette, policy *firiclient.RedactionPolicy) *Replayer {
+	if policy == nil {
+		policy = firiclient.NewRedactionPolicy()
+	}
+	return &Replayer{
+		c:      c,
+		policy: policy,
+		used:   make([]bool, len(c.Interactions)),
+	}
+}
+
+func (r *Replayer) Do(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	redacted, err := url.Parse(r.policy.URL(req.URL))
+	if err != nil {
+		return nil, err
+	}
+	key := matchKey(req.Method, redacted, r.policy.String(string(body)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.c.Interactions {
+		if r.used[i] {
+			continue
+		}
+		u, err := url.Parse(in.Request.URL)
+		if err != nil {
+			return nil, err
+		}
+		if matchKey(in.Request.Method, u, in.Request.Body) != key {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			StatusCode:    in.Response.StatusCode,
+			Status:        in.Response.Status,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %v %v", ErrNoInteraction, req.Method, req.URL.Path)
+}
+
+// Remaining returns the number of recorded interactions not yet replayed.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, u := range r.used {
+		if !u {
+			n++
+		}
+	}
+	return n
+}
+
+func matchKey(method string, u *url.URL, body string) string {
+	// Encode sorts by key, so parameter order does not matter
+	return method + " " + u.Path + "?" + u.Query().Encode() + "\n" + body
+}
+
+// readBody reads and replaces body so it can be read again.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
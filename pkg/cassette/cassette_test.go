@@ -0,0 +1,118 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+const apiKey = "my-api-key"
+
+func fakeFiri(r *http.Request) (*http.Response, error) {
+	body := `[]`
+	switch r.URL.Path {
+	case "/v2/orders":
+		body = `{"id":42}`
+	case "/v2/balances":
+		body = `[{"currency":"NOK","balance":"100","hold":"0","available":"100"}]`
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+	}, nil
+}
+
+func newClient(doer firiclient.Doer) firiclient.PrivateAPI {
+	base, _ := url.Parse("https://api.firi.com")
+	signer := firiclient.NewSigner("client", apiKey, []byte("secret"))
+	public := firiclient.New(base, doer, firiclient.WithLogger(firiclient.NopLogger()))
+	return firiclient.NewAuthenticatedClient(base, signer, public, doer)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	policy := firiclient.NewRedactionPolicy()
+	policy.AddSecret(apiKey)
+	rec := NewRecorder(fakeFiri, policy)
+
+	c := newClient(rec.Do)
+	order := &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 100, Amount: 1}
+	if _, err := c.PostOrder(ctx, order); err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	if _, err := c.GetBalancesV2(ctx); err != nil {
+		t.Fatalf("error getting balances: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatalf("error saving cassette: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), apiKey) {
+		t.Errorf("cassette leaks api key:\n%s", data)
+	}
+
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("error loading cassette: %v", err)
+	}
+	replayer := NewReplayer(cassette, policy)
+	replay := newClient(replayer.Do)
+
+	// replayed out of recorded order, with fresh signatures
+	balances, err := replay.GetBalancesV2(ctx)
+	if err != nil {
+		t.Fatalf("error replaying balances: %v", err)
+	}
+	if len(balances) != 1 || balances[0].Available != 100 {
+		t.Errorf("unexpected balances=%+v", balances)
+	}
+	res, err := replay.PostOrder(ctx, order)
+	if err != nil {
+		t.Fatalf("error replaying order: %v", err)
+	}
+	if res.Id != 42 {
+		t.Errorf("unexpected order id=%v", res.Id)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("expected all interactions replayed, %v remaining", replayer.Remaining())
+	}
+
+	// a different body does not match
+	_, err = replay.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 101, Amount: 1})
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction, got %v", err)
+	}
+}
+
+func TestReplayMatchesRedactedQueryParams(t *testing.T) {
+	get := func(doer firiclient.Doer, query string) error {
+		req, _ := http.NewRequest("GET", "https://api.firi.com/v2/balances?"+query, nil)
+		_, err := doer(req)
+		return err
+	}
+	rec := NewRecorder(fakeFiri, nil)
+	if err := get(rec.Do, "signature=abc&timestamp=1&market=BTCNOK"); err != nil {
+		t.Fatalf("error recording: %v", err)
+	}
+
+	replayer := NewReplayer(rec.Cassette(), nil)
+	if err := get(replayer.Do, "market=ETHNOK&signature=def&timestamp=2"); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction for another market, got %v", err)
+	}
+	if err := get(replayer.Do, "market=BTCNOK&signature=def&timestamp=2"); err != nil {
+		t.Errorf("expected a fresh signature to match the redacted recording, got %v", err)
+	}
+}
@@ -0,0 +1,481 @@
+// Package conditional emulates stop-loss, take-profit and trailing stop
+// orders, which Firi does not support, by watching tickers and placing limit
+// orders once a trigger price is crossed.
+package conditional
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var (
+	ErrInvalidCondition = errors.New("conditional: invalid condition")
+	ErrUnknownCondition = errors.New("conditional: unknown or finished condition")
+)
+
+type Kind string
+
+const (
+	// StopLoss triggers when the price moves against the position: a sell
+	// when the bid falls to Trigger, a buy when the ask rises to it.
+	StopLoss Kind = "stop_loss"
+	// TakeProfit triggers when the price moves in favour: a sell when the
+	// bid rises to Trigger, a buy when the ask falls to it.
+	TakeProfit Kind = "take_profit"
+	// TrailingStop is a stop loss with a trigger that follows the best price
+	// seen at a distance of Trail.
+	TrailingStop Kind = "trailing_stop"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	// StatusTriggering is saved before the order of a triggered condition is
+	// posted. A condition still triggering after a restart may or may not
+	// have placed its order, and is not fired again until it is resolved.
+	StatusTriggering Status = "triggering"
+	StatusTriggered  Status = "triggered"
+	StatusCancelled  Status = "cancelled"
+	StatusFailed     Status = "failed"
+)
+
+// Condition is a conditional order. Side is the side of the limit order placed
+// when it triggers.
+type Condition struct {
+	ID      string               `json:"id"`
+	Market  firiclient.MarketID  `json:"market"`
+	Kind    Kind                 `json:"kind"`
+	Side    firiclient.OrderType `json:"side"`
+	Amount  float64              `json:"amount"`
+	Trigger float64              `json:"trigger"`
+	// Trail is the distance of a trailing stop from the best price seen.
+	Trail float64 `json:"trail,omitempty"`
+	// Extreme is the best price seen by a trailing stop.
+	Extreme float64 `json:"extreme,omitempty"`
+	// Limit is the price of the order placed. When zero, the order is priced
+	// at the triggering bid or ask, moved by the engine's Slippage to cross.
+	Limit float64 `json:"limit,omitempty"`
+	// Group links conditions one-cancels-other: when one triggers, the
+	// others are cancelled.
+	Group string `json:"group,omitempty"`
+
+	Status      Status    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	TriggeredAt time.Time `json:"triggered_at,omitempty"`
+	OrderID     int64     `json:"order_id,omitempty"`
+	DryRun      bool      `json:"dry_run,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+func (c *Condition) validate() error {
+	switch {
+	case c.Market == "":
+		return fmt.Errorf("%w: missing market", ErrInvalidCondition)
+	case c.Side != firiclient.Bid && c.Side != firiclient.Ask:
+		return fmt.Errorf("%w: side=%q", ErrInvalidCondition, c.Side)
+	case c.Amount <= 0:
+		return fmt.Errorf("%w: amount=%v", ErrInvalidCondition, c.Amount)
+	case c.Limit < 0:
+		return fmt.Errorf("%w: limit=%v", ErrInvalidCondition, c.Limit)
+	}
+	switch c.Kind {
+	case StopLoss, TakeProfit:
+		if c.Trigger <= 0 {
+			return fmt.Errorf("%w: trigger=%v", ErrInvalidCondition, c.Trigger)
+		}
+	case TrailingStop:
+		if c.Trail <= 0 {
+			return fmt.Errorf("%w: trail=%v", ErrInvalidCondition, c.Trail)
+		}
+	default:
+		return fmt.Errorf("%w: kind=%q", ErrInvalidCondition, c.Kind)
+	}
+	return nil
+}
+
+// price is the price the triggered order trades at: the bid for sells and the ask for buys.
+func (c *Condition) price(t firiclient.MarketTicker) float64 {
+	if c.Side == firiclient.Ask {
+		return t.Bid
+	}
+	return t.Ask
+}
+
+// update moves a trailing stop along with the price, and reports whether the
+// condition is triggered at price p.
+func (c *Condition) update(p float64) bool {
+	sell := c.Side == firiclient.Ask
+	switch c.Kind {
+	case TrailingStop:
+		if c.Extreme == 0 || (sell && p > c.Extreme) || (!sell && p < c.Extreme) {
+			c.Extreme = p
+		}
+		if sell {
+			c.Trigger = c.Extreme - c.Trail
+		} else {
+			c.Trigger = c.Extreme + c.Trail
+		}
+		fallthrough
+	case StopLoss:
+		return (sell && p <= c.Trigger) || (!sell && p >= c.Trigger)
+	case TakeProfit:
+		return (sell && p >= c.Trigger) || (!sell && p <= c.Trigger)
+	}
+	return false
+}
+
+// OrderAPI is the part of the API the engine uses.
+type OrderAPI interface {
+	GetMarketTickersV2(ctx context.Context) (firiclient.MarketTickers, error)
+	PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error)
+}
+
+type Config struct {
+	Interval time.Duration
+	// Slippage prices orders without a Limit this fraction past the
+	// triggering price, so they cross the book. Defaults to 0.005.
+	Slippage float64
+	// DryRun logs and records triggered conditions without placing orders.
+	DryRun bool
+}
+
+// Engine watches tickers and places orders for conditions as they trigger.
+// Every change is saved to the store, so conditions survive restarts.
+type Engine struct {
+	api     OrderAPI
+	store   Store
+	cfg     Config
+	nowFunc func() time.Time
+
+	mu    sync.Mutex
+	conds map[string]*Condition
+	// posting holds the conditions whose orders are being posted by Check.
+	posting map[string]bool
+}
+
+// NewEngine returns an engine with the conditions saved in store. A nil
+// store keeps conditions in memory only.
+func NewEngine(api OrderAPI, store Store, cfg Config) (*Engine, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Slippage <= 0 {
+		cfg.Slippage = 0.005
+	}
+	e := &Engine{
+		api:     api,
+		store:   store,
+		cfg:     cfg,
+		nowFunc: time.Now,
+		conds:   map[string]*Condition{},
+		posting: map[string]bool{},
+	}
+	if store != nil {
+		saved, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for i := range saved {
+			e.conds[saved[i].ID] = &saved[i]
+		}
+	}
+	return e, nil
+}
+
+// Add validates and saves new conditions, and returns them with ids assigned.
+func (e *Engine) Add(conds ...Condition) ([]Condition, error) {
+	return e.add("", conds)
+}
+
+// OCO adds conditions as a one-cancels-other group, such as a stop loss and
+// a take profit on the same position.
+func (e *Engine) OCO(conds ...Condition) ([]Condition, error) {
+	if len(conds) < 2 {
+		return nil, fmt.Errorf("%w: OCO needs at least 2 conditions", ErrInvalidCondition)
+	}
+	return e.add(xid.New().String(), conds)
+}
+
+func (e *Engine) add(group string, conds []Condition) ([]Condition, error) {
+	now := e.nowFunc()
+	added := make([]Condition, 0, len(conds))
+	for _, c := range conds {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		c.ID = xid.New().String()
+		c.Group = group
+		c.Status = StatusPending
+		c.CreatedAt = now
+		c.Extreme = 0
+		c.TriggeredAt = time.Time{}
+		c.OrderID = 0
+		c.Error = ""
+		added = append(added, c)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range added {
+		c := added[i]
+		e.conds[c.ID] = &c
+	}
+	if err := e.save(); err != nil {
+		for _, c := range added {
+			delete(e.conds, c.ID)
+		}
+		return nil, err
+	}
+	return added, nil
+}
+
+// Cancel cancels a pending condition. Other conditions in its OCO group are
+// left pending.
+func (e *Engine) Cancel(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.conds[id]
+	if !ok || c.Status != StatusPending {
+		return fmt.Errorf("%w: %v", ErrUnknownCondition, id)
+	}
+	c.Status = StatusCancelled
+	return e.save()
+}
+
+// Resolve settles a condition left triggering by a restart, once it is known
+// whether its order was placed. With an order id, the condition is triggered
+// by that order and the rest of its OCO group is cancelled. With 0, no order
+// was placed and the condition is pending again, to fire on the next check.
+func (e *Engine) Resolve(id string, orderID int64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.conds[id]
+	if !ok || c.Status != StatusTriggering || e.posting[id] {
+		return fmt.Errorf("%w: %v", ErrUnknownCondition, id)
+	}
+	prev := *c
+	var cancelled []*Condition
+	if orderID > 0 {
+		c.Status = StatusTriggered
+		c.OrderID = orderID
+		cancelled = e.cancelGroup(c)
+	} else {
+		c.Status = StatusPending
+		c.TriggeredAt = time.Time{}
+		c.DryRun = false
+	}
+	if err := e.save(); err != nil {
+		*c = prev
+		for _, o := range cancelled {
+			o.Status = StatusPending
+		}
+		return err
+	}
+	return nil
+}
+
+// Conditions returns all conditions, oldest first.
+func (e *Engine) Conditions() []Condition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.list()
+}
+
+func (e *Engine) list() []Condition {
+	res := make([]Condition, 0, len(e.conds))
+	for _, c := range e.conds {
+		res = append(res, *c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+func (e *Engine) save() error {
+	if e.store == nil {
+		return nil
+	}
+	return e.store.Save(e.list())
+}
+
+// Run polls until ctx is done. Failed polls are logged and retried on the next tick.
+func (e *Engine) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	for _, c := range e.Conditions() {
+		if c.Status == StatusTriggering {
+			log.Warn().Msgf("conditional: %v %v was triggering when last stopped and waits to be resolved", c.Kind, c.ID)
+		}
+	}
+	t := time.NewTicker(e.cfg.Interval)
+	defer t.Stop()
+	for {
+		if _, err := e.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Error().Err(err).Msgf("conditional: poll failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Poll fetches tickers once and checks all pending conditions against them.
+func (e *Engine) Poll(ctx context.Context) ([]Condition, error) {
+	tickers, err := e.api.GetMarketTickersV2(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e.Check(ctx, tickers)
+}
+
+// Check checks pending conditions against tickers, places orders for those
+// that trigger, and returns them. A condition whose order fails is marked
+// failed and not retried, as the price has moved on; the rest of its OCO group
+// stays pending. Triggered conditions are saved as triggering before their
+// orders are posted, so a crash cannot fire them twice.
+func (e *Engine) Check(ctx context.Context, tickers firiclient.MarketTickers) ([]Condition, error) {
+	log := zerolog.Ctx(ctx)
+	byMarket := map[firiclient.MarketID]firiclient.MarketTicker{}
+	for _, t := range tickers {
+		byMarket[firiclient.MarketID(t.MarketID)] = t
+	}
+
+	type trigger struct {
+		c     *Condition
+		price float64
+		req   *firiclient.CreateOrderRequest
+	}
+	e.mu.Lock()
+	// an OCO group fires one condition at a time
+	firing := map[string]bool{}
+	for _, c := range e.conds {
+		if c.Group != "" && c.Status == StatusTriggering {
+			firing[c.Group] = true
+		}
+	}
+	var triggers []trigger
+	moved := false
+	for _, snapshot := range e.list() {
+		c := e.conds[snapshot.ID]
+		if c.Status != StatusPending || (c.Group != "" && firing[c.Group]) {
+			continue
+		}
+		t, ok := byMarket[c.Market]
+		if !ok {
+			continue
+		}
+		p := c.price(t)
+		if p <= 0 {
+			continue
+		}
+		hit := c.update(p)
+		moved = moved || c.Extreme != snapshot.Extreme
+		if !hit {
+			continue
+		}
+		if c.Group != "" {
+			firing[c.Group] = true
+		}
+		c.Status = StatusTriggering
+		e.posting[c.ID] = true
+		c.TriggeredAt = e.nowFunc()
+		c.DryRun = e.cfg.DryRun
+		r := &firiclient.CreateOrderRequest{Market: string(c.Market), Type: c.Side, Price: e.limit(c, p), Amount: c.Amount}
+		triggers = append(triggers, trigger{c: c, price: p, req: r})
+	}
+	if len(triggers) == 0 && !moved {
+		e.mu.Unlock()
+		return nil, nil
+	}
+	if err := e.save(); err != nil {
+		for _, t := range triggers {
+			t.c.Status = StatusPending
+			t.c.TriggeredAt = time.Time{}
+			t.c.DryRun = false
+			delete(e.posting, t.c.ID)
+		}
+		e.mu.Unlock()
+		return nil, err
+	}
+	e.mu.Unlock()
+	if len(triggers) == 0 {
+		return nil, nil
+	}
+
+	// post without holding the lock; triggering conditions are left alone meanwhile
+	orderIDs := make([]int64, len(triggers))
+	errs := make([]error, len(triggers))
+	for i, t := range triggers {
+		c, r := t.c, t.req
+		if e.cfg.DryRun {
+			log.Info().Msgf("conditional: dry run: %v %v triggered at %v, would place %v %v@%v", c.Kind, c.ID, t.price, r.Type, r.Amount, r.Price)
+		} else if res, err := e.api.PostOrder(ctx, r); err != nil {
+			errs[i] = err
+			log.Error().Err(err).Msgf("conditional: %v %v triggered at %v, but placing order failed: %v", c.Kind, c.ID, t.price, err)
+		} else {
+			orderIDs[i] = res.Id
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	triggered := make([]Condition, 0, len(triggers))
+	for i, t := range triggers {
+		c := t.c
+		delete(e.posting, c.ID)
+		if errs[i] != nil {
+			c.Status = StatusFailed
+			c.Error = errs[i].Error()
+		} else {
+			c.Status = StatusTriggered
+			c.OrderID = orderIDs[i]
+			e.cancelGroup(c)
+		}
+		triggered = append(triggered, *c)
+	}
+	return triggered, e.save()
+}
+
+// cancelGroup cancels the pending conditions in the OCO group of triggered,
+// and returns them.
+func (e *Engine) cancelGroup(triggered *Condition) []*Condition {
+	if triggered.Group == "" {
+		return nil
+	}
+	var res []*Condition
+	for _, c := range e.conds {
+		if c.Group == triggered.Group && c.ID != triggered.ID && c.Status == StatusPending {
+			c.Status = StatusCancelled
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (e *Engine) limit(c *Condition, p float64) float64 {
+	if c.Limit > 0 {
+		return c.Limit
+	}
+	if c.Side == firiclient.Ask {
+		return p * (1 - e.cfg.Slippage)
+	}
+	return p * (1 + e.cfg.Slippage)
+}
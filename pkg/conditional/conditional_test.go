@@ -0,0 +1,231 @@
+package conditional
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type fakeAPI struct {
+	tickers firiclient.MarketTickers
+	posted  []firiclient.CreateOrderRequest
+	err     error
+	onPost  func()
+}
+
+func (f *fakeAPI) GetMarketTickersV2(ctx context.Context) (firiclient.MarketTickers, error) {
+	return f.tickers, nil
+}
+
+func (f *fakeAPI) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	if f.onPost != nil {
+		f.onPost()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.posted = append(f.posted, *r)
+	return &firiclient.CreateOrderResponse{Id: int64(len(f.posted))}, nil
+}
+
+func (f *fakeAPI) price(bid, ask float64) {
+	f.tickers = firiclient.MarketTickers{{MarketID: "BTCNOK", Bid: bid, Ask: ask}}
+}
+
+func poll(t *testing.T, e *Engine) []Condition {
+	t.Helper()
+	triggered, err := e.Poll(context.Background())
+	if err != nil {
+		t.Fatalf("error polling: %v", err)
+	}
+	return triggered
+}
+
+func TestOCOStopLossTakeProfit(t *testing.T) {
+	api := &fakeAPI{}
+	e, _ := NewEngine(api, nil, Config{})
+	conds, err := e.OCO(
+		Condition{Market: "BTCNOK", Kind: StopLoss, Side: firiclient.Ask, Amount: 1, Trigger: 90},
+		Condition{Market: "BTCNOK", Kind: TakeProfit, Side: firiclient.Ask, Amount: 1, Trigger: 120, Limit: 119},
+	)
+	if err != nil {
+		t.Fatalf("error adding OCO: %v", err)
+	}
+
+	api.price(100, 101)
+	if len(poll(t, e)) != 0 {
+		t.Fatalf("expected nothing to trigger")
+	}
+	api.price(89, 90)
+	triggered := poll(t, e)
+	if len(triggered) != 1 || triggered[0].ID != conds[0].ID || triggered[0].OrderID != 1 {
+		t.Fatalf("expected stop loss to trigger, got %+v", triggered)
+	}
+	if p := api.posted[0]; p.Type != firiclient.Ask || math.Abs(p.Price-88.555) > 1e-9 || p.Amount != 1 {
+		t.Errorf("expected a crossing sell, got %+v", p)
+	}
+
+	api.price(130, 131)
+	if len(poll(t, e)) != 0 || len(api.posted) != 1 {
+		t.Errorf("expected take profit to be cancelled by the stop loss")
+	}
+	if c := e.Conditions(); c[1].Status != StatusCancelled {
+		t.Errorf("expected cancelled take profit, got %+v", c[1])
+	}
+}
+
+func TestTrailingStop(t *testing.T) {
+	api := &fakeAPI{}
+	e, _ := NewEngine(api, nil, Config{})
+	e.Add(Condition{Market: "BTCNOK", Kind: TrailingStop, Side: firiclient.Ask, Amount: 1, Trail: 10})
+
+	for _, bid := range []float64{100, 120, 115, 111} {
+		api.price(bid, bid+1)
+		if len(poll(t, e)) != 0 {
+			t.Fatalf("expected no trigger at bid %v", bid)
+		}
+	}
+	if c := e.Conditions()[0]; c.Extreme != 120 || c.Trigger != 110 {
+		t.Errorf("expected stop trailing the high of 120, got %+v", c)
+	}
+	api.price(110, 111)
+	if len(poll(t, e)) != 1 {
+		t.Errorf("expected trailing stop to trigger at 110")
+	}
+}
+
+func TestDryRunAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conditions.json")
+	api := &fakeAPI{}
+	e, _ := NewEngine(api, NewFileStore(path), Config{DryRun: true})
+	e.Add(
+		Condition{Market: "BTCNOK", Kind: TakeProfit, Side: firiclient.Bid, Amount: 1, Trigger: 90},
+		Condition{Market: "BTCNOK", Kind: TrailingStop, Side: firiclient.Bid, Amount: 1, Trail: 5},
+	)
+	api.price(99, 100)
+	poll(t, e)
+
+	// a restarted engine keeps the trailing stop where it was
+	e, err := NewEngine(api, NewFileStore(path), Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("error loading conditions: %v", err)
+	}
+	if c := e.Conditions(); len(c) != 2 || c[1].Extreme != 100 || c[1].Trigger != 105 {
+		t.Fatalf("expected saved conditions, got %+v", c)
+	}
+
+	api.price(88, 89)
+	triggered := poll(t, e)
+	if len(triggered) != 1 || !triggered[0].DryRun || len(api.posted) != 0 {
+		t.Errorf("expected dry run trigger without orders, got %+v posted=%v", triggered, api.posted)
+	}
+}
+
+func TestTriggeringIsSavedBeforePosting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conditions.json")
+	api := &fakeAPI{}
+	e, _ := NewEngine(api, NewFileStore(path), Config{})
+	e.OCO(
+		Condition{Market: "BTCNOK", Kind: StopLoss, Side: firiclient.Ask, Amount: 1, Trigger: 90},
+		Condition{Market: "BTCNOK", Kind: TakeProfit, Side: firiclient.Ask, Amount: 1, Trigger: 120},
+	)
+
+	// a crash while posting leaves the condition triggering, not pending
+	var saved []Condition
+	api.onPost = func() {
+		saved, _ = NewFileStore(path).Load()
+		// the engine is not locked while posting
+		e.Conditions()
+	}
+	api.err = errors.New("boom")
+	api.price(89, 90)
+	triggered := poll(t, e)
+	if len(saved) != 2 || saved[0].Status != StatusTriggering {
+		t.Errorf("expected the stop loss saved as triggering before posting, got %+v", saved)
+	}
+	if len(triggered) != 1 || triggered[0].Status != StatusFailed {
+		t.Fatalf("expected a failed stop loss, got %+v", triggered)
+	}
+
+	// a failed stop loss leaves the take profit in place
+	api.err = nil
+	api.onPost = nil
+	api.price(130, 131)
+	triggered = poll(t, e)
+	if len(triggered) != 1 || triggered[0].Kind != TakeProfit || triggered[0].Status != StatusTriggered {
+		t.Errorf("expected the take profit to still trigger, got %+v", triggered)
+	}
+
+	// a condition left triggering by a crash is not fired again
+	saved[1].Status = StatusCancelled
+	NewFileStore(path).Save(saved)
+	e, _ = NewEngine(api, NewFileStore(path), Config{})
+	api.posted = nil
+	api.price(80, 81)
+	if triggered := poll(t, e); len(triggered) != 0 || len(api.posted) != 0 {
+		t.Errorf("expected no orders for a condition left triggering, got %+v", triggered)
+	}
+}
+
+func TestResolveTriggering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conditions.json")
+	api := &fakeAPI{}
+	e, _ := NewEngine(api, NewFileStore(path), Config{})
+	conds, _ := e.OCO(
+		Condition{Market: "BTCNOK", Kind: StopLoss, Side: firiclient.Ask, Amount: 1, Trigger: 90},
+		Condition{Market: "BTCNOK", Kind: TakeProfit, Side: firiclient.Ask, Amount: 1, Trigger: 120},
+	)
+	stop, profit := conds[0].ID, conds[1].ID
+	if err := e.Resolve(stop, 0); !errors.Is(err, ErrUnknownCondition) {
+		t.Errorf("expected only triggering conditions to be resolved, got %v", err)
+	}
+
+	// crash while posting the stop loss
+	var saved []Condition
+	api.onPost = func() { saved, _ = NewFileStore(path).Load() }
+	api.price(89, 90)
+	poll(t, e)
+	NewFileStore(path).Save(saved)
+
+	// no order was placed, so the stop loss fires again once resolved
+	e, _ = NewEngine(api, NewFileStore(path), Config{})
+	api.onPost = nil
+	api.posted = nil
+	if err := e.Resolve(stop, 0); err != nil {
+		t.Fatalf("error resolving: %v", err)
+	}
+	if triggered := poll(t, e); len(triggered) != 1 || triggered[0].ID != stop || len(api.posted) != 1 {
+		t.Errorf("expected the stop loss to fire again, got %+v", triggered)
+	}
+
+	// the order was placed, so the take profit is cancelled
+	NewFileStore(path).Save(saved)
+	e, _ = NewEngine(api, NewFileStore(path), Config{})
+	if err := e.Resolve(stop, 42); err != nil {
+		t.Fatalf("error resolving: %v", err)
+	}
+	loaded, _ := NewFileStore(path).Load()
+	for _, c := range loaded {
+		if c.ID == stop && (c.Status != StatusTriggered || c.OrderID != 42) {
+			t.Errorf("expected the stop loss triggered by order 42, got %+v", c)
+		}
+		if c.ID == profit && c.Status != StatusCancelled {
+			t.Errorf("expected the take profit cancelled, got %+v", c)
+		}
+	}
+}
+
+func TestInvalidCondition(t *testing.T) {
+	e, _ := NewEngine(&fakeAPI{}, nil, Config{})
+	_, err := e.Add(Condition{Market: "BTCNOK", Kind: StopLoss, Side: firiclient.Ask, Amount: 1})
+	if !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected ErrInvalidCondition without trigger, got %v", err)
+	}
+	if err := e.Cancel("nope"); !errors.Is(err, ErrUnknownCondition) {
+		t.Errorf("expected ErrUnknownCondition, got %v", err)
+	}
+}
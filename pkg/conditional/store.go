@@ -0,0 +1,64 @@
+package conditional
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Store persists conditions between restarts.
+type Store interface {
+	Load() ([]Condition, error)
+	Save(conds []Condition) error
+}
+
+// FileStore keeps conditions in a JSON file. Saves write a temporary file
+// and rename it over the old one, so a crash never leaves a partial file.
+type FileStore struct {
+	Path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load returns no conditions if the file does not exist yet.
+func (s *FileStore) Load() ([]Condition, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var conds []Condition
+	if err := json.Unmarshal(data, &conds); err != nil {
+		return nil, err
+	}
+	return conds, nil
+}
+
+func (s *FileStore) Save(conds []Condition) error {
+	data, err := json.MarshalIndent(conds, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.Path)
+}
@@ -0,0 +1,312 @@
+// Package execution works large orders into the market in smaller child
+// orders, to limit their market impact.
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var (
+	ErrInvalidOrder = errors.New("execution: invalid order")
+	// ErrIncomplete is returned when a schedule ends before the order is filled.
+	ErrIncomplete = errors.New("execution: order not completely filled")
+)
+
+// dust is the remaining amount below which an order counts as filled.
+const dust = 1e-9
+
+// API is the part of the private API the algorithms use.
+type API interface {
+	GetOrderbookV2(ctx context.Context, marketId firiclient.MarketID) (*firiclient.Orderbook, error)
+	GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error)
+	GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error)
+	PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error)
+	CancelOrder(ctx context.Context, orderId int64, marketId firiclient.MarketID) (*firiclient.ActiveOrder, error)
+}
+
+// Order is the parent order an algorithm executes. Limit is the worst price
+// child orders may be placed at, or 0 for no limit where the algorithm allows it.
+type Order struct {
+	Market firiclient.MarketID
+	Side   firiclient.OrderType
+	Amount float64
+	Limit  float64
+}
+
+func (o *Order) validate() error {
+	if o.Market == "" || (o.Side != firiclient.Bid && o.Side != firiclient.Ask) || o.Amount <= 0 || o.Limit < 0 {
+		return fmt.Errorf("%w: %+v", ErrInvalidOrder, *o)
+	}
+	return nil
+}
+
+// Progress of an execution. Notional is valued at the prices of the child
+// orders, so the average price is an upper bound for buys and a lower bound
+// for sells.
+type Progress struct {
+	Filled    float64
+	Remaining float64
+	Notional  float64
+	Orders    int
+	Paused    bool
+	Done      bool
+}
+
+func (p Progress) AveragePrice() float64 {
+	if p.Filled == 0 {
+		return 0
+	}
+	return p.Notional / p.Filled
+}
+
+// control holds the progress and pause state shared by the algorithms.
+type control struct {
+	api        API
+	order      Order
+	poll       time.Duration
+	onProgress func(Progress)
+
+	mu       sync.Mutex
+	progress Progress
+	// changed is closed and replaced on every pause and resume
+	changed chan struct{}
+
+	// history caches the closed orders for a poll interval, shared by the
+	// child orders, as the full history is costly to fetch.
+	historyMu sync.Mutex
+	history   firiclient.ActiveOrders
+	historyAt time.Time
+}
+
+func newControl(api API, order Order, poll time.Duration, onProgress func(Progress)) control {
+	if poll <= 0 {
+		poll = 2 * time.Second
+	}
+	return control{
+		api:        api,
+		order:      order,
+		poll:       poll,
+		onProgress: onProgress,
+		progress:   Progress{Remaining: order.Amount},
+		changed:    make(chan struct{}),
+	}
+}
+
+// Progress returns the progress so far.
+func (c *control) Progress() Progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.progress
+}
+
+// Pause cancels the working child order and stops placing new ones until Resume.
+func (c *control) Pause() {
+	c.setPaused(true)
+}
+
+func (c *control) Resume() {
+	c.setPaused(false)
+}
+
+func (c *control) setPaused(paused bool) {
+	c.mu.Lock()
+	if c.progress.Paused == paused {
+		c.mu.Unlock()
+		return
+	}
+	c.progress.Paused = paused
+	close(c.changed)
+	c.changed = make(chan struct{})
+	p := c.progress
+	c.mu.Unlock()
+	c.report(p)
+}
+
+func (c *control) state() (bool, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.progress.Paused, c.changed
+}
+
+func (c *control) waitResumed(ctx context.Context) error {
+	for {
+		paused, changed := c.state()
+		if !paused {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (c *control) remaining() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.progress.Remaining
+}
+
+func (c *control) record(placed bool, matched, price float64) {
+	c.mu.Lock()
+	if placed {
+		c.progress.Orders++
+	}
+	c.progress.Filled += matched
+	c.progress.Notional += matched * price
+	c.progress.Remaining = c.order.Amount - c.progress.Filled
+	p := c.progress
+	c.mu.Unlock()
+	if matched > 0 {
+		c.report(p)
+	}
+}
+
+func (c *control) finish(err error) error {
+	c.mu.Lock()
+	c.progress.Done = true
+	p := c.progress
+	c.mu.Unlock()
+	c.report(p)
+	return err
+}
+
+func (c *control) report(p Progress) {
+	if c.onProgress != nil {
+		c.onProgress(p)
+	}
+}
+
+// maxStatusErrors is how many status checks of a child order may fail in a
+// row before it is cancelled.
+const maxStatusErrors = 5
+
+// work places a child order and waits until it is closed, the deadline
+// passes, the execution is paused or ctx is done, then cancels what is left
+// of it. A zero deadline waits until the order is closed. Failed status
+// checks are retried on the next tick, up to maxStatusErrors in a row, after
+// which the order is cancelled. The matched amount is recorded even when an
+// error is returned.
+func (c *control) work(ctx context.Context, amount, price float64, deadline time.Time) error {
+	res, err := c.api.PostOrder(ctx, &firiclient.CreateOrderRequest{
+		Market: string(c.order.Market),
+		Type:   c.order.Side,
+		Price:  price,
+		Amount: amount,
+	})
+	if err != nil {
+		return err
+	}
+	c.record(true, 0, price)
+
+	_, changed := c.state()
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		expired = t.C
+	}
+	tick := time.NewTicker(c.poll)
+	defer tick.Stop()
+	statusErrors := 0
+	for {
+		select {
+		case <-ctx.Done():
+			// cancel even though ctx is done, so nothing is left resting
+			cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			matched, err := c.cancel(cctx, res.Id)
+			c.record(false, matched, price)
+			return errors.Join(ctx.Err(), err)
+		case <-changed:
+		case <-expired:
+		case <-tick.C:
+			matched, open, err := c.status(ctx, res.Id)
+			if err != nil {
+				if statusErrors++; statusErrors < maxStatusErrors {
+					continue
+				}
+				cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				matched, cerr := c.cancel(cctx, res.Id)
+				c.record(false, matched, price)
+				return errors.Join(err, cerr)
+			}
+			statusErrors = 0
+			if !open {
+				c.record(false, matched, price)
+				return nil
+			}
+			continue
+		}
+		matched, err := c.cancel(ctx, res.Id)
+		c.record(false, matched, price)
+		return err
+	}
+}
+
+// cancel cancels a child order and returns what it matched. If the cancel
+// fails, as it does for an order that just closed, the matched amount is
+// looked up instead.
+func (c *control) cancel(ctx context.Context, id int64) (float64, error) {
+	o, err := c.api.CancelOrder(ctx, id, c.order.Market)
+	if err == nil {
+		return o.Matched, nil
+	}
+	matched, open, serr := c.status(ctx, id)
+	if serr != nil {
+		return 0, fmt.Errorf("execution: cancelling order %v failed with %v, and its status is unknown: %w", id, err, serr)
+	}
+	if open {
+		return matched, fmt.Errorf("execution: cancelling order %v: %w", id, err)
+	}
+	return matched, nil
+}
+
+// status returns the matched amount of a child order, and whether it is still
+// open. The history is only searched once the order has left the active orders.
+func (c *control) status(ctx context.Context, id int64) (float64, bool, error) {
+	active, err := c.api.GetActiveOrdersInMarket(ctx, c.order.Market)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, o := range active {
+		if o.Id == id {
+			return o.Matched, true, nil
+		}
+	}
+	closed, err := c.closedOrders(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, o := range closed {
+		if o.Id == id {
+			return o.Matched, false, nil
+		}
+	}
+	return 0, false, fmt.Errorf("execution: order %v is neither active nor closed", id)
+}
+
+// closedOrders returns the history of closed orders, fetched at most once a
+// poll interval. The lock is held while fetching, so concurrent child orders
+// share one fetch.
+func (c *control) closedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	if !c.historyAt.IsZero() && time.Since(c.historyAt) < c.poll {
+		return c.history, nil
+	}
+	closed, err := c.api.GetAllFilledAndClosedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.history, c.historyAt = closed, time.Now()
+	return closed, nil
+}
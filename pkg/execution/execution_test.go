@@ -0,0 +1,255 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/backtest"
+	"github.com/esiqveland/firi/pkg/candles"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func newExchange(bid, ask, qty float64) *backtest.Exchange {
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 100_000, "BTC": 100})
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Orderbook: &firiclient.Orderbook{
+		Bids: []firiclient.Order{{Price: bid, Quantity: qty}},
+		Asks: []firiclient.Order{{Price: ask, Quantity: qty}},
+	}})
+	return ex
+}
+
+// sellInto fills resting bids with market sells of amount until ctx is done.
+func sellInto(ctx context.Context, ex *backtest.Exchange, price, amount float64) {
+	for ctx.Err() == nil {
+		ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+			{OrderType: firiclient.Ask, Price: price, Amount: amount, CreatedAt: t0},
+		}})
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func activeAmount(ex *backtest.Exchange) float64 {
+	active, _ := ex.GetActiveOrders(context.Background())
+	total := 0.0
+	for _, o := range active {
+		total += o.Remaining
+	}
+	return total
+}
+
+func TestIceberg(t *testing.T) {
+	ex := newExchange(99, 101, 10)
+	var reports []Progress
+	a, err := NewIceberg(ex, IcebergConfig{
+		Order:      Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 3, Limit: 100},
+		Visible:    1,
+		Poll:       time.Millisecond,
+		OnProgress: func(p Progress) { reports = append(reports, p) },
+	})
+	if err != nil {
+		t.Fatalf("error creating iceberg: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go sellInto(ctx, ex, 100, 0.4)
+	go func() {
+		for ctx.Err() == nil {
+			if shown := activeAmount(ex); shown > 1+1e-9 {
+				t.Errorf("expected at most 1 shown, got %v", shown)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := a.Run(ctx); err != nil {
+		t.Fatalf("error running iceberg: %v", err)
+	}
+	cancel()
+	p := a.Progress()
+	if !p.Done || !almostEqual(p.Filled, 3) || p.Orders != 3 || !almostEqual(p.AveragePrice(), 100) {
+		t.Errorf("expected 3 filled at 100 in 3 slices, got %+v", p)
+	}
+	if last := reports[len(reports)-1]; !last.Done {
+		t.Errorf("expected final progress report, got %+v", last)
+	}
+}
+
+func TestIcebergPauseAndCancel(t *testing.T) {
+	ex := newExchange(99, 101, 10)
+	a, _ := NewIceberg(ex, IcebergConfig{
+		Order:   Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 3, Limit: 100},
+		Visible: 1,
+		Poll:    time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+
+	waitFor(t, func() bool { return activeAmount(ex) == 1 })
+	a.Pause()
+	waitFor(t, func() bool { return activeAmount(ex) == 0 })
+	a.Resume()
+	waitFor(t, func() bool { return activeAmount(ex) == 1 })
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if shown := activeAmount(ex); shown != 0 {
+		t.Errorf("expected no orders left after cancelling, got %v", shown)
+	}
+	if p := a.Progress(); p.Orders != 2 || p.Filled != 0 {
+		t.Errorf("expected 2 unfilled child orders, got %+v", p)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTWAP(t *testing.T) {
+	ex := newExchange(99, 101, 10)
+	a, err := NewTWAP(ex, ScheduleConfig{
+		Order:    Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 3, Limit: 102},
+		Duration: 60 * time.Millisecond,
+		Slices:   3,
+		Poll:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("error creating TWAP: %v", err)
+	}
+	start := time.Now()
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("error running TWAP: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("expected the schedule to take its duration, took %v", elapsed)
+	}
+	if p := a.Progress(); !almostEqual(p.Filled, 3) || p.Orders != 3 || !almostEqual(ex.Balance("BTC"), 103) {
+		t.Errorf("expected 3 bought in 3 slices, got %+v", p)
+	}
+}
+
+func TestVWAPIncompleteBeyondLimit(t *testing.T) {
+	ex := newExchange(99, 101, 10)
+	a, err := NewVWAP(ex, ScheduleConfig{
+		Order:    Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 3, Limit: 100},
+		Duration: 20 * time.Millisecond,
+		Slices:   2,
+		Weights:  []float64{1, 2},
+		Poll:     time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("error creating VWAP: %v", err)
+	}
+	if err := a.Run(context.Background()); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("expected ErrIncomplete with the ask above the limit, got %v", err)
+	}
+	if p := a.Progress(); p.Orders != 0 {
+		t.Errorf("expected no orders above the limit, got %+v", p)
+	}
+}
+
+func TestVolumeProfile(t *testing.T) {
+	history := []candles.Candle{
+		{Start: t0.Add(-24 * time.Hour), Volume: 1},
+		{Start: t0.Add(-24*time.Hour + 30*time.Minute), Volume: 2},
+		{Start: t0.Add(-48*time.Hour + 90*time.Minute), Volume: 3},
+		{Start: t0.Add(-3 * time.Hour), Volume: 100},
+	}
+	weights := VolumeProfile(history, t0, 3*time.Hour, 3)
+	if len(weights) != 3 || weights[0] != 3 || weights[1] != 3 || weights[2] != 3 {
+		t.Errorf("unexpected weights %v", weights)
+	}
+	weights = VolumeProfile(history, t0, 2*time.Hour, 2)
+	if weights[0] != 3 || weights[1] != 3 {
+		t.Errorf("unexpected weights %v", weights)
+	}
+}
+
+// flakyStatus fails the first `failures` listings of active orders.
+type flakyStatus struct {
+	*backtest.Exchange
+	failures int
+}
+
+func (f *flakyStatus) GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("temporary failure")
+	}
+	return f.Exchange.GetActiveOrdersInMarket(ctx, marketId)
+}
+
+func TestChildOrderSurvivesFailedStatusChecks(t *testing.T) {
+	ex := newExchange(99, 101, 10)
+	api := &flakyStatus{Exchange: ex, failures: maxStatusErrors - 1}
+	a, _ := NewIceberg(api, IcebergConfig{
+		Order:   Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 1, Limit: 102},
+		Visible: 1,
+		Poll:    time.Millisecond,
+	})
+	if err := a.Run(context.Background()); err != nil {
+		t.Fatalf("expected transient status failures to be retried, got %v", err)
+	}
+	if p := a.Progress(); !almostEqual(p.Filled, 1) {
+		t.Errorf("expected 1 filled, got %+v", p)
+	}
+
+	// an order whose status stays unknown is cancelled rather than left resting
+	api.failures = 100
+	a, _ = NewIceberg(api, IcebergConfig{
+		Order:   Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 1, Limit: 90},
+		Visible: 1,
+		Poll:    time.Millisecond,
+	})
+	if err := a.Run(context.Background()); err == nil {
+		t.Errorf("expected an error when the status stays unknown")
+	}
+	if shown := activeAmount(ex); shown != 0 {
+		t.Errorf("expected the child order to be cancelled, got %v resting", shown)
+	}
+}
+
+// countingAPI counts fetches of the order history.
+type countingAPI struct {
+	*backtest.Exchange
+	history int
+}
+
+func (c *countingAPI) GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	c.history++
+	return c.Exchange.GetAllFilledAndClosedOrders(ctx)
+}
+
+func TestRestingChildOrderDoesNotFetchHistory(t *testing.T) {
+	api := &countingAPI{Exchange: newExchange(99, 101, 10)}
+	a, _ := NewIceberg(api, IcebergConfig{
+		Order:   Order{Market: firiclient.BTCNOK, Side: firiclient.Bid, Amount: 1, Limit: 90},
+		Visible: 1,
+		Poll:    time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	a.Run(ctx)
+	if api.history != 0 {
+		t.Errorf("expected no history fetches while the child order rests, got %v", api.history)
+	}
+}
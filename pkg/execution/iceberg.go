@@ -0,0 +1,53 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+type IcebergConfig struct {
+	Order
+	// Visible is the amount shown in the book at a time.
+	Visible float64
+	// Poll is how often the visible order is checked. Defaults to 2s.
+	Poll       time.Duration
+	OnProgress func(Progress)
+}
+
+// Iceberg shows a slice of the order at the limit price, and places the next
+// slice when it fills.
+type Iceberg struct {
+	control
+	visible float64
+}
+
+func NewIceberg(api API, cfg IcebergConfig) (*Iceberg, error) {
+	if err := cfg.Order.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Limit <= 0 || cfg.Visible <= 0 {
+		return nil, fmt.Errorf("%w: iceberg needs a limit and visible amount", ErrInvalidOrder)
+	}
+	return &Iceberg{
+		control: newControl(api, cfg.Order, cfg.Poll, cfg.OnProgress),
+		visible: cfg.Visible,
+	}, nil
+}
+
+// Run executes the order until it is filled or ctx is done.
+func (a *Iceberg) Run(ctx context.Context) error {
+	for {
+		remaining := a.remaining()
+		if remaining <= dust {
+			return a.finish(nil)
+		}
+		if err := a.waitResumed(ctx); err != nil {
+			return a.finish(err)
+		}
+		if err := a.work(ctx, math.Min(a.visible, remaining), a.order.Limit, time.Time{}); err != nil {
+			return a.finish(err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/candles"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type ScheduleConfig struct {
+	Order
+	// Duration is spread evenly over Slices. Time spent paused extends it.
+	Duration time.Duration
+	Slices   int
+	// Weights is the share of the order in each slice. TWAP weights slices
+	// equally; VWAP requires one weight per slice, see VolumeProfile.
+	Weights []float64
+	// Slippage prices each child order this fraction past the best price
+	// on the other side of the book, so it crosses. Defaults to 0.002.
+	Slippage float64
+	// Poll is how often the working order is checked. Defaults to 2s.
+	Poll       time.Duration
+	OnProgress func(Progress)
+}
+
+// Schedule splits the order into slices placed over time. Each slice is due
+// its share of the order plus what earlier slices did not fill, and what it
+// does not fill by the end of the slice is cancelled.
+type Schedule struct {
+	control
+	slices   int
+	interval time.Duration
+	weights  []float64
+	slippage float64
+}
+
+// NewTWAP executes the order in equally sized slices.
+func NewTWAP(api API, cfg ScheduleConfig) (*Schedule, error) {
+	if cfg.Weights != nil {
+		return nil, fmt.Errorf("%w: TWAP has equal weights", ErrInvalidOrder)
+	}
+	cfg.Weights = make([]float64, cfg.Slices)
+	for i := range cfg.Weights {
+		cfg.Weights[i] = 1
+	}
+	return newSchedule(api, cfg)
+}
+
+// NewVWAP executes the order in slices sized by cfg.Weights, typically the
+// expected volume traded in each slice.
+func NewVWAP(api API, cfg ScheduleConfig) (*Schedule, error) {
+	return newSchedule(api, cfg)
+}
+
+func newSchedule(api API, cfg ScheduleConfig) (*Schedule, error) {
+	if err := cfg.Order.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Slices <= 0 || cfg.Duration <= 0 || len(cfg.Weights) != cfg.Slices {
+		return nil, fmt.Errorf("%w: schedule needs a duration and a weight per slice", ErrInvalidOrder)
+	}
+	total := 0.0
+	for _, w := range cfg.Weights {
+		if w < 0 {
+			return nil, fmt.Errorf("%w: negative weight", ErrInvalidOrder)
+		}
+		total += w
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%w: weights sum to zero", ErrInvalidOrder)
+	}
+	weights := make([]float64, len(cfg.Weights))
+	for i, w := range cfg.Weights {
+		weights[i] = w / total
+	}
+	if cfg.Slippage <= 0 {
+		cfg.Slippage = 0.002
+	}
+	return &Schedule{
+		control:  newControl(api, cfg.Order, cfg.Poll, cfg.OnProgress),
+		slices:   cfg.Slices,
+		interval: cfg.Duration / time.Duration(cfg.Slices),
+		weights:  weights,
+		slippage: cfg.Slippage,
+	}, nil
+}
+
+// Run executes the schedule until its last slice ends or ctx is done. If the
+// order is not completely filled by then, the error is ErrIncomplete.
+func (a *Schedule) Run(ctx context.Context) error {
+	due := 0.0
+	for i := 0; i < a.slices; i++ {
+		if err := a.waitResumed(ctx); err != nil {
+			return a.finish(err)
+		}
+		end := time.Now().Add(a.interval)
+		due += a.weights[i]
+		amount := math.Min(a.order.Amount*due-a.Progress().Filled, a.remaining())
+		if amount > dust {
+			price, err := a.price(ctx)
+			if err != nil {
+				return a.finish(err)
+			}
+			if price > 0 {
+				if err := a.work(ctx, amount, price, end); err != nil {
+					return a.finish(err)
+				}
+			}
+		}
+		if err := a.sleepUntil(ctx, end); err != nil {
+			return a.finish(err)
+		}
+	}
+	if r := a.remaining(); r > dust {
+		return a.finish(fmt.Errorf("%w: %v of %v left", ErrIncomplete, r, a.order.Amount))
+	}
+	return a.finish(nil)
+}
+
+// price crosses the best price on the other side of the book by the
+// slippage, bounded by the limit. It is 0 when there is nothing to trade
+// against within the limit.
+func (a *Schedule) price(ctx context.Context) (float64, error) {
+	book, err := a.api.GetOrderbookV2(ctx, a.order.Market)
+	if err != nil {
+		return 0, err
+	}
+	if a.order.Side == firiclient.Bid {
+		if len(book.Asks) == 0 {
+			return 0, nil
+		}
+		price := book.Asks[0].Price * (1 + a.slippage)
+		if a.order.Limit > 0 {
+			if book.Asks[0].Price > a.order.Limit {
+				return 0, nil
+			}
+			price = math.Min(price, a.order.Limit)
+		}
+		return price, nil
+	}
+	if len(book.Bids) == 0 {
+		return 0, nil
+	}
+	price := book.Bids[0].Price * (1 - a.slippage)
+	if a.order.Limit > 0 {
+		if book.Bids[0].Price < a.order.Limit {
+			return 0, nil
+		}
+		price = math.Max(price, a.order.Limit)
+	}
+	return price, nil
+}
+
+func (a *Schedule) sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// VolumeProfile returns VWAP weights for slices of d starting at start, from
+// the volume traded at the same time of day in history. Slices with no
+// history get the average weight.
+func VolumeProfile(history []candles.Candle, start time.Time, d time.Duration, slices int) []float64 {
+	const day = 24 * time.Hour
+	sinceMidnight := func(t time.Time) time.Duration {
+		t = t.In(start.Location())
+		return t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+	}
+	step := d / time.Duration(slices)
+	first := sinceMidnight(start)
+
+	weights := make([]float64, slices)
+	for _, c := range history {
+		offset := (sinceMidnight(c.Start) - first + day) % day
+		if i := int(offset / step); i < slices {
+			weights[i] += c.Volume
+		}
+	}
+
+	total, n := 0.0, 0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+			n++
+		}
+	}
+	for i, w := range weights {
+		if w == 0 {
+			if n == 0 {
+				weights[i] = 1
+			} else {
+				weights[i] = total / float64(n)
+			}
+		}
+	}
+	return weights
+}
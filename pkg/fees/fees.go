@@ -0,0 +1,184 @@
+// Package fees models maker and taker fee schedules with volume tiers, and
+// computes fees, net proceeds and breakeven prices of trades.
+package fees
+
+import (
+	"sort"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/tax"
+)
+
+// Rates are maker and taker fees as a fraction of the traded cost.
+type Rates struct {
+	Maker float64
+	Taker float64
+}
+
+func (r Rates) Rate(maker bool) float64 {
+	if maker {
+		return r.Maker
+	}
+	return r.Taker
+}
+
+// NetProceeds is the NOK an order of amount at price brings in after fees:
+// positive for asks, and negative, the cost including fees, for bids.
+func (r Rates) NetProceeds(side firiclient.OrderType, price, amount float64, maker bool) float64 {
+	cost := price * amount
+	fee := cost * r.Rate(maker)
+	if side == firiclient.Ask {
+		return cost - fee
+	}
+	return -(cost + fee)
+}
+
+// Tier applies from a trading volume in NOK over the schedule's window.
+type Tier struct {
+	MinVolume float64
+	Rates
+}
+
+// DefaultWindow is the trailing period trading volume is measured over.
+const DefaultWindow = 30 * 24 * time.Hour
+
+type Schedule struct {
+	// Tiers apply to markets without their own tiers.
+	Tiers []Tier
+	// Markets holds tiers for markets with their own fees.
+	Markets map[firiclient.MarketID][]Tier
+	// Window is the period volume is measured over. Defaults to DefaultWindow.
+	Window time.Duration
+}
+
+// Flat returns a schedule with the same rates for every market and volume.
+func Flat(r Rates) *Schedule {
+	return &Schedule{Tiers: []Tier{{Rates: r}}}
+}
+
+// Rates returns the rates of the highest tier reached by volume in market.
+// Below the lowest tier there are no fees.
+func (s *Schedule) Rates(market firiclient.MarketID, volume float64) Rates {
+	tiers, ok := s.Markets[market]
+	if !ok {
+		tiers = s.Tiers
+	}
+	var best *Tier
+	for i := range tiers {
+		t := &tiers[i]
+		if t.MinVolume <= volume && (best == nil || t.MinVolume > best.MinVolume) {
+			best = t
+		}
+	}
+	if best == nil {
+		return Rates{}
+	}
+	return best.Rates
+}
+
+func (s *Schedule) window() time.Duration {
+	if s.Window <= 0 {
+		return DefaultWindow
+	}
+	return s.Window
+}
+
+// TradeFee is a trade with its fee. Net is the NOK the trade brought in after
+// fees: the cost less the fee for sells, and minus the cost and fee for buys.
+type TradeFee struct {
+	Trade  firiclient.HistoricTrade
+	Volume float64
+	Rate   float64
+	Fee    float64
+	Net    float64
+}
+
+// Apply computes the fee of every trade, oldest first, at the tier reached by
+// the volume traded in the window before it. Costs are taken to be in NOK.
+func (s *Schedule) Apply(trades firiclient.HistoricTrades) []TradeFee {
+	sorted := append(firiclient.HistoricTrades(nil), trades...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	res := make([]TradeFee, 0, len(sorted))
+	volume, first := 0.0, 0
+	for _, t := range sorted {
+		for first < len(sorted) && !sorted[first].Date.After(t.Date.Add(-s.window())) {
+			volume -= sorted[first].Cost
+			first++
+		}
+		rate := s.Rates(firiclient.MarketID(t.Market), volume).Rate(t.IsMaker)
+		f := TradeFee{Trade: t, Volume: volume, Rate: rate, Fee: t.Cost * rate}
+		if firiclient.OrderType(t.Side) == firiclient.Ask {
+			f.Net = t.Cost - f.Fee
+		} else {
+			f.Net = -(t.Cost + f.Fee)
+		}
+		res = append(res, f)
+		volume += t.Cost
+	}
+	return res
+}
+
+// FeeFunc returns a tax.FeeFunc with the fees of trades, so gains are
+// reported net of fees. Trades not among them have no fee.
+func (s *Schedule) FeeFunc(trades firiclient.HistoricTrades) tax.FeeFunc {
+	byId := map[string]float64{}
+	for _, f := range s.Apply(trades) {
+		byId[f.Trade.Id] = f.Fee
+	}
+	return func(t firiclient.HistoricTrade) float64 {
+		return byId[t.Id]
+	}
+}
+
+type Summary struct {
+	Trades    int
+	Volume    float64
+	MakerFees float64
+	TakerFees float64
+	Fees      float64
+	Net       float64
+}
+
+func Summarize(fees []TradeFee) Summary {
+	var s Summary
+	for _, f := range fees {
+		s.Trades++
+		s.Volume += f.Trade.Cost
+		s.Fees += f.Fee
+		s.Net += f.Net
+		if f.Trade.IsMaker {
+			s.MakerFees += f.Fee
+		} else {
+			s.TakerFees += f.Fee
+		}
+	}
+	return s
+}
+
+// BreakevenAsk is the lowest price an amount bought at entry can be sold at
+// without a loss, paying buyRate on the buy and sellRate on the sale.
+func BreakevenAsk(entry, buyRate, sellRate float64) float64 {
+	return entry * (1 + buyRate) / (1 - sellRate)
+}
+
+// BreakevenBid is the highest price an amount sold at exit can be bought
+// back at without a loss, paying sellRate on the sale and buyRate on the buy.
+func BreakevenBid(exit, sellRate, buyRate float64) float64 {
+	return exit * (1 - sellRate) / (1 + buyRate)
+}
+
+// BreakevenAsk is BreakevenAsk at the schedule's rates in market for volume.
+func (s *Schedule) BreakevenAsk(market firiclient.MarketID, volume, entry float64, entryMaker, exitMaker bool) float64 {
+	r := s.Rates(market, volume)
+	return BreakevenAsk(entry, r.Rate(entryMaker), r.Rate(exitMaker))
+}
+
+// BreakevenBid is BreakevenBid at the schedule's rates in market for volume.
+func (s *Schedule) BreakevenBid(market firiclient.MarketID, volume, exit float64, exitMaker, entryMaker bool) float64 {
+	r := s.Rates(market, volume)
+	return BreakevenBid(exit, r.Rate(exitMaker), r.Rate(entryMaker))
+}
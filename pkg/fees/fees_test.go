@@ -0,0 +1,121 @@
+package fees
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/tax"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func trade(id string, side firiclient.OrderType, day int, cost float64, maker bool) firiclient.HistoricTrade {
+	return firiclient.HistoricTrade{
+		Id:             id,
+		Market:         "BTCNOK",
+		Price:          cost,
+		PriceCurrency:  "NOK",
+		Amount:         1,
+		AmountCurrency: "BTC",
+		Cost:           cost,
+		CostCurrency:   "NOK",
+		Side:           string(side),
+		IsMaker:        maker,
+		Date:           t0.Add(time.Duration(day) * 24 * time.Hour),
+	}
+}
+
+var schedule = &Schedule{
+	Tiers: []Tier{
+		{MinVolume: 0, Rates: Rates{Maker: 0.002, Taker: 0.004}},
+		{MinVolume: 100_000, Rates: Rates{Maker: 0.001, Taker: 0.002}},
+	},
+	Markets: map[firiclient.MarketID][]Tier{
+		"DAINOK": {{Rates: Rates{Maker: 0, Taker: 0.001}}},
+	},
+}
+
+func TestRates(t *testing.T) {
+	if r := schedule.Rates(firiclient.BTCNOK, 99_999); r.Taker != 0.004 {
+		t.Errorf("expected base tier, got %+v", r)
+	}
+	if r := schedule.Rates(firiclient.BTCNOK, 100_000); r.Taker != 0.002 {
+		t.Errorf("expected second tier, got %+v", r)
+	}
+	if r := schedule.Rates(firiclient.DAINOK, 1e9); r.Taker != 0.001 || r.Maker != 0 {
+		t.Errorf("expected market override, got %+v", r)
+	}
+	if r := (&Schedule{Tiers: []Tier{{MinVolume: 10}}}).Rates(firiclient.BTCNOK, 0); r != (Rates{}) {
+		t.Errorf("expected no fees below the lowest tier, got %+v", r)
+	}
+}
+
+func TestApplyTiersOnTrailingVolume(t *testing.T) {
+	trades := firiclient.HistoricTrades{
+		trade("3", firiclient.Ask, 40, 50_000, false),
+		trade("1", firiclient.Bid, 0, 100_000, false),
+		trade("2", firiclient.Bid, 1, 10_000, true),
+	}
+	res := schedule.Apply(trades)
+	if res[0].Trade.Id != "1" || res[0].Fee != 400 || res[0].Net != -100_400 {
+		t.Errorf("expected first trade at the base taker rate, got %+v", res[0])
+	}
+	if res[1].Volume != 100_000 || res[1].Fee != 10 {
+		t.Errorf("expected second trade at the second tier maker rate, got %+v", res[1])
+	}
+	// the first two trades are out of the 30 day window
+	if res[2].Volume != 0 || res[2].Fee != 200 || res[2].Net != 49_800 {
+		t.Errorf("expected third trade back at the base tier, got %+v", res[2])
+	}
+
+	s := Summarize(res)
+	if s.Trades != 3 || s.Fees != 610 || s.MakerFees != 10 || s.TakerFees != 600 || s.Net != -100_400-10_010+49_800 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+}
+
+func TestFeeFuncForTax(t *testing.T) {
+	trades := firiclient.HistoricTrades{
+		trade("1", firiclient.Bid, 0, 100_000, false),
+		trade("2", firiclient.Ask, 1, 110_000, false),
+	}
+	c := tax.NewCalculator(tax.YearEndPrices{2023: {"BTC": 110_000}})
+	c.Fee = schedule.FeeFunc(trades)
+	r, err := c.Calculate(context.Background(), trades)
+	if err != nil {
+		t.Fatalf("error calculating: %v", err)
+	}
+	y, _ := r.Year(2023)
+	// 10000 gain less 400 buy fee and 220 sell fee at the second tier
+	if !almostEqual(y.Net, 10_000-400-220) {
+		t.Errorf("expected gain net of fees, got %+v", y)
+	}
+}
+
+func TestBreakeven(t *testing.T) {
+	r := Rates{Maker: 0.002, Taker: 0.004}
+	ask := schedule.BreakevenAsk(firiclient.BTCNOK, 0, 100_000, false, true)
+	if !almostEqual(ask, BreakevenAsk(100_000, 0.004, 0.002)) {
+		t.Errorf("expected schedule rates to be used, got %v", ask)
+	}
+	// buying and selling at breakeven nets zero
+	spent := r.NetProceeds(firiclient.Bid, 100_000, 0.5, false)
+	got := r.NetProceeds(firiclient.Ask, ask, 0.5, true)
+	if !almostEqual(spent+got, 0) {
+		t.Errorf("expected zero net at breakeven ask, got %v", spent+got)
+	}
+
+	bid := BreakevenBid(100_000, 0.004, 0.002)
+	got = r.NetProceeds(firiclient.Ask, 100_000, 0.5, false)
+	spent = r.NetProceeds(firiclient.Bid, bid, 0.5, true)
+	if !almostEqual(spent+got, 0) {
+		t.Errorf("expected zero net at breakeven bid, got %v", spent+got)
+	}
+}
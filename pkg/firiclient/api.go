@@ -0,0 +1,35 @@
+package firiclient
+
+import (
+	"context"
+	"time"
+)
+
+// PublicAPI is the unauthenticated part of the Firi API.
+type PublicAPI interface {
+	GetServerTime(ctx context.Context) (time.Time, error)
+	GetMarketsV1(ctx context.Context) (Markets, error)
+	GetMarketsV2(ctx context.Context) (Markets, error)
+	GetMarketTickersV2(ctx context.Context) (MarketTickers, error)
+	GetMarketTickerV2(ctx context.Context, marketId MarketID) (*MarketTicker, error)
+	GetMarketTradeHistoryV2(ctx context.Context, marketId MarketID) (TradeHistory, error)
+	GetOrderbookV2(ctx context.Context, marketId MarketID) (*Orderbook, error)
+}
+
+// PrivateAPI is the full Firi API available to an authenticated client.
+// It lets simulated and wrapped clients stand in for the real one.
+type PrivateAPI interface {
+	PublicAPI
+	GetActiveOrders(ctx context.Context) (ActiveOrders, error)
+	GetAllFilledAndClosedOrders(ctx context.Context) (ActiveOrders, error)
+	GetAllTrades(ctx context.Context) (HistoricTrades, error)
+	GetActiveOrdersInMarket(ctx context.Context, marketId MarketID) (ActiveOrders, error)
+	DeleteAllOrders(ctx context.Context) (ActiveOrders, error)
+	CancelOrder(ctx context.Context, orderId int64, marketId MarketID) (*ActiveOrder, error)
+	PostOrder(ctx context.Context, r *CreateOrderRequest) (*CreateOrderResponse, error)
+	PostWithdrawal(ctx context.Context, coinId string, r *CreateWithdrawalRequest) (*CreateWithdrawalResponse, error)
+	GetBalancesV2(ctx context.Context) (Balances, error)
+}
+
+var _ PublicAPI = (*publicClient)(nil)
+var _ PrivateAPI = (*authClient)(nil)
@@ -0,0 +1,130 @@
+package firiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxBodySize limits how much of a response body is read.
+const DefaultMaxBodySize = 32 << 20
+
+// maxErrorBodySize limits how much of an error response is kept in an APIError.
+const maxErrorBodySize = 64 << 10
+
+var ErrBodyTooLarge = errors.New("firiclient: response body too large")
+
+var ErrTrailingData = errors.New("firiclient: unexpected data after json value")
+
+// WithMaxBodySize limits response bodies to n bytes; larger responses fail with ErrBodyTooLarge.
+func WithMaxBodySize(n int64) Option {
+	return func(c *publicClient) {
+		c.maxBodySize = n
+	}
+}
+
+// limitedReader fails with ErrBodyTooLarge instead of silently truncating
+// like io.LimitReader.
+type limitedReader struct {
+	r io.Reader
+	// n is one more than the limit, so a body of exactly the limit can reach EOF.
+	n int64
+	// exceeded is set once more than the limit has been read. A decoder may
+	// already hold a complete value by then and ignore the read error.
+	exceeded bool
+}
+
+func newLimitedReader(r io.Reader, limit int64) *limitedReader {
+	return &limitedReader{r: r, n: limit + 1}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n <= 0 {
+		l.exceeded = true
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedReader) check(err error) error {
+	if l.exceeded {
+		return ErrBodyTooLarge
+	}
+	return err
+}
+
+// drain reads what is left of the body, up to the limit, so the connection
+// can be reused once the body is closed.
+func (l *limitedReader) drain() {
+	io.Copy(io.Discard, l)
+}
+
+// decode streams the JSON response body into v.
+func (c *publicClient) decode(resp *http.Response, v interface{}) error {
+	r := newLimitedReader(resp.Body, c.maxBodySize)
+	defer r.drain()
+	dec := json.NewDecoder(r)
+	err := dec.Decode(v)
+	if err == nil {
+		err = end(dec)
+	}
+	return r.check(err)
+}
+
+// end fails with ErrTrailingData unless dec is at the end of its input.
+func end(dec *json.Decoder) error {
+	_, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	syntax := &json.SyntaxError{}
+	if err == nil || errors.As(err, &syntax) {
+		return ErrTrailingData
+	}
+	return err
+}
+
+// errorResponse reads the start of an unexpected response into an APIError.
+func (c *publicClient) errorResponse(req *http.Request, resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return err
+	}
+	return c.apiError(req, resp, body)
+}
+
+// decodeList decodes a JSON array one element at a time, calling fn for each
+// element without holding the whole list in memory.
+func decodeList[T any](r io.Reader, fn func(T) error) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("firiclient: expected json array, got %v", tok)
+	}
+	for dec.More() {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return end(dec)
+}
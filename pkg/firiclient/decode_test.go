@@ -0,0 +1,183 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tradesJson(n int) []byte {
+	trades := make(HistoricTrades, n)
+	for i := range trades {
+		trades[i] = HistoricTrade{
+			Id:             fmt.Sprintf("trade-%d", i),
+			Market:         "BTCNOK",
+			Price:          300000 + float64(i),
+			PriceCurrency:  "NOK",
+			Amount:         0.001,
+			AmountCurrency: "BTC",
+			Cost:           300,
+			CostCurrency:   "NOK",
+			Side:           "bid",
+			IsMaker:        i%2 == 0,
+			Date:           time.Date(2023, 1, 1, 0, 0, i, 0, time.UTC),
+		}
+	}
+	data, err := json.Marshal(trades)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func jsonDoer(body []byte) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+}
+
+func newTestAuthClient(doer Doer, opts ...Option) *authClient {
+	base, _ := url.Parse("https://api.firi.com")
+	opts = append([]Option{WithLogger(NopLogger())}, opts...)
+	public := New(base, doer, opts...)
+	return NewAuthenticatedClient(base, NewSigner("client", "key", secretKey), public, doer)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	data := tradesJson(10)
+	ctx := context.Background()
+
+	c := newTestAuthClient(jsonDoer(data), WithMaxBodySize(int64(len(data))))
+	if _, err := c.GetAllTrades(ctx); err != nil {
+		t.Errorf("expected body of exactly max size to decode, got %v", err)
+	}
+
+	c = newTestAuthClient(jsonDoer(data), WithMaxBodySize(int64(len(data)-1)))
+	if _, err := c.GetAllTrades(ctx); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("expected ErrBodyTooLarge, got %v", err)
+	}
+}
+
+func TestStreamAllTrades(t *testing.T) {
+	c := newTestAuthClient(jsonDoer(tradesJson(100)))
+	count := 0
+	err := c.StreamAllTrades(context.Background(), func(t HistoricTrade) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error streaming trades: %v", err)
+	}
+	if count != 100 {
+		t.Errorf("expected 100 trades, got %v", count)
+	}
+
+	stop := errors.New("stop")
+	err = c.StreamAllTrades(context.Background(), func(t HistoricTrade) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected stream to stop with callback error, got %v", err)
+	}
+
+	err = decodeList(strings.NewReader(`{"id":1}`), func(t HistoricTrade) error { return nil })
+	if err == nil {
+		t.Errorf("expected error decoding non-array")
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	ctx := context.Background()
+	data := append(tradesJson(2), " \n"...)
+	c := newTestAuthClient(jsonDoer(data))
+	if _, err := c.GetAllTrades(ctx); err != nil {
+		t.Errorf("expected trailing whitespace to be accepted, got %v", err)
+	}
+	if err := c.StreamAllTrades(ctx, func(HistoricTrade) error { return nil }); err != nil {
+		t.Errorf("expected trailing whitespace to be accepted when streaming, got %v", err)
+	}
+
+	for _, trailing := range []string{"[]", "}", "x", `{"id":1}`} {
+		data := append(tradesJson(2), trailing...)
+		c := newTestAuthClient(jsonDoer(data))
+		if _, err := c.GetAllTrades(ctx); !errors.Is(err, ErrTrailingData) {
+			t.Errorf("expected ErrTrailingData for %q, got %v", trailing, err)
+		}
+		if err := c.StreamAllTrades(ctx, func(HistoricTrade) error { return nil }); !errors.Is(err, ErrTrailingData) {
+			t.Errorf("expected ErrTrailingData streaming %q, got %v", trailing, err)
+		}
+	}
+}
+
+func TestBodyIsDrained(t *testing.T) {
+	body := &bytes.Reader{}
+	doer := func(r *http.Request) (*http.Response, error) {
+		body.Reset(append(tradesJson(2), strings.Repeat(" ", 8192)...))
+		return &http.Response{StatusCode: 200, Status: "200 OK", Body: io.NopCloser(body)}, nil
+	}
+	c := newTestAuthClient(doer)
+	if _, err := c.GetAllTrades(context.Background()); err != nil {
+		t.Fatalf("error getting trades: %v", err)
+	}
+	if body.Len() != 0 {
+		t.Errorf("expected the body to be drained, %v bytes left", body.Len())
+	}
+
+	stop := errors.New("stop")
+	c.StreamAllTrades(context.Background(), func(HistoricTrade) error { return stop })
+	if body.Len() != 0 {
+		t.Errorf("expected the body to be drained after stopping a stream, %v bytes left", body.Len())
+	}
+}
+
+// BenchmarkDecodeTrades compares buffering the whole body before decoding,
+// as the client used to, with streaming the body through a decoder.
+func BenchmarkDecodeTrades(b *testing.B) {
+	data := tradesJson(5000)
+
+	b.Run("readall-unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body, err := io.ReadAll(bytes.NewReader(data))
+			if err != nil {
+				b.Fatal(err)
+			}
+			m := HistoricTrades{}
+			if err := json.Unmarshal(body, &m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		c := newTestAuthClient(jsonDoer(data))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m := HistoricTrades{}
+			resp := &http.Response{Body: io.NopCloser(bytes.NewReader(data))}
+			if err := c.decode(resp, &m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			err := decodeList(bytes.NewReader(data), func(t HistoricTrade) error { return nil })
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// endpoint describes one API call. call and stream turn it into a request,
+// sign it if a signer is set, and map the response to a result or an error.
+type endpoint struct {
+	// name is the client method, used to name spans
+	name   string
+	method string
+	path   string
+	// body is sent as JSON if set
+	body interface{}
+	// accept lists the successful statuses, 200 if empty
+	accept []int
+
+	base   *url.URL
+	signer *signer
+}
+
+func (c *publicClient) endpoint(name, method, path string) endpoint {
+	return endpoint{
+		name:   name,
+		method: method,
+		path:   path,
+		base:   c.baseurl,
+	}
+}
+
+func (c *authClient) endpoint(name, method, path string) endpoint {
+	return endpoint{
+		name:   name,
+		method: method,
+		path:   path,
+		base:   c.baseurl,
+		signer: c.signer,
+	}
+}
+
+func (e endpoint) withBody(body interface{}) endpoint {
+	e.body = body
+	return e
+}
+
+func (e endpoint) accepting(statuses ...int) endpoint {
+	e.accept = statuses
+	return e
+}
+
+func (e endpoint) accepts(status int) bool {
+	if len(e.accept) == 0 {
+		return status == 200
+	}
+	for _, s := range e.accept {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// call performs e and decodes a successful response into T.
+func call[T any](ctx context.Context, c *publicClient, e endpoint) (res T, err error) {
+	ctx, span := c.startSpan(ctx, e.name)
+	defer func() { endSpan(span, err) }()
+
+	resp, err := c.send(ctx, e)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	err = c.decode(resp, &res)
+	return res, err
+}
+
+// stream performs e and hands each element of the JSON array response to fn.
+func stream[T any](ctx context.Context, c *publicClient, e endpoint, fn func(T) error) (err error) {
+	ctx, span := c.startSpan(ctx, e.name)
+	defer func() { endSpan(span, err) }()
+
+	resp, err := c.send(ctx, e)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	r := newLimitedReader(resp.Body, c.maxBodySize)
+	defer r.drain()
+	return r.check(decodeList(r, fn))
+}
+
+// send performs e, returning the response only if its status is accepted.
+func (c *publicClient) send(ctx context.Context, e endpoint) (*http.Response, error) {
+	uri, err := e.base.Parse(e.path)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if e.body != nil {
+		data, err := json.Marshal(e.body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, e.method, uri.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if e.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	var resp *http.Response
+	if e.signer != nil {
+		resp, err = c.doSigned(req, e.signer)
+	} else {
+		resp, err = c.do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !e.accepts(resp.StatusCode) {
+		defer resp.Body.Close()
+		return nil, c.errorResponse(req, resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,70 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func statusDoer(status int, body string) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		}, nil
+	}
+}
+
+func TestEndpointAcceptedStatuses(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestAuthClient(statusDoer(201, `{"id":7}`))
+	res, err := c.PostOrder(ctx, &CreateOrderRequest{Market: "BTCNOK", Type: Bid, Price: 1, Amount: 1})
+	if err != nil || res.Id != 7 {
+		t.Errorf("expected 201 to be accepted for PostOrder, got res=%+v err=%v", res, err)
+	}
+
+	c = newTestAuthClient(statusDoer(201, `[]`))
+	_, err = c.GetActiveOrders(ctx)
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 201 {
+		t.Errorf("expected APIError for unexpected status, got %v", err)
+	}
+}
+
+func TestGetMarketTickerKeepsMarketFromResponse(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestAuthClient(statusDoer(200, `{"market":"BTCNOK","bid":"1","ask":"2","spread":"1"}`))
+	ticker, err := c.GetMarketTickerV2(ctx, "btcnok")
+	if err != nil {
+		t.Fatalf("error getting ticker: %v", err)
+	}
+	if ticker.MarketID != "BTCNOK" {
+		t.Errorf("expected market from response, got %v", ticker.MarketID)
+	}
+
+	c = newTestAuthClient(statusDoer(200, `{"bid":"1","ask":"2","spread":"1"}`))
+	ticker, err = c.GetMarketTickerV2(ctx, BTCNOK)
+	if err != nil {
+		t.Fatalf("error getting ticker: %v", err)
+	}
+	if ticker.MarketID != "BTCNOK" {
+		t.Errorf("expected requested market when response has none, got %v", ticker.MarketID)
+	}
+}
+
+func TestGetBalancesDecodesCurrencies(t *testing.T) {
+	c := newTestAuthClient(statusDoer(200, `[{"currency":"BTC","balance":"1.5","hold":"0.5","available":"1"},{"currency":"NOK","balance":"100","hold":"0","available":"100"}]`))
+	balances, err := c.GetBalancesV2(context.Background())
+	if err != nil {
+		t.Fatalf("error getting balances: %v", err)
+	}
+	want := Balances{{Currency: "BTC", Balance: 1.5, Hold: 0.5, Available: 1}, {Currency: "NOK", Balance: 100, Available: 100}}
+	if len(balances) != 2 || balances[0] != want[0] || balances[1] != want[1] {
+		t.Errorf("expected %+v, got %+v", want, balances)
+	}
+}
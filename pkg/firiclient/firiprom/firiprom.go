@@ -0,0 +1,72 @@
+// Package firiprom exports firiclient request metrics to Prometheus.
+package firiprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type Metrics struct {
+	requests           *prometheus.CounterVec
+	errors             *prometheus.CounterVec
+	duration           *prometheus.HistogramVec
+	rateLimit          *prometheus.GaugeVec
+	rateLimitRemaining *prometheus.GaugeVec
+}
+
+var _ firiclient.Metrics = (*Metrics)(nil)
+
+// New creates the collectors and registers them with reg.
+// Use it with firiclient.WithMetrics.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	labels := []string{"client", "method", "endpoint", "status_class"}
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "firi",
+			Name:      "requests_total",
+			Help:      "Requests made to the Firi API.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "firi",
+			Name:      "request_errors_total",
+			Help:      "Requests to the Firi API that failed or returned a 4xx/5xx status.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "firi",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests to the Firi API.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"client", "method", "endpoint"}),
+		rateLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "firi",
+			Name:      "ratelimit_limit",
+			Help:      "Request budget of the current rate limit window, as reported by the API.",
+		}, []string{"client"}),
+		rateLimitRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "firi",
+			Name:      "ratelimit_remaining",
+			Help:      "Requests left in the current rate limit window, as reported by the API.",
+		}, []string{"client"}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.errors, m.duration, m.rateLimit, m.rateLimitRemaining} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) ObserveRequest(info firiclient.RequestInfo) {
+	client := string(info.Client)
+	m.requests.WithLabelValues(client, info.Method, info.Endpoint, info.StatusClass).Inc()
+	m.duration.WithLabelValues(client, info.Method, info.Endpoint).Observe(info.Duration.Seconds())
+	if info.Err != nil || info.Status >= 400 {
+		m.errors.WithLabelValues(client, info.Method, info.Endpoint, info.StatusClass).Inc()
+	}
+}
+
+func (m *Metrics) SetRateLimit(client firiclient.ClientType, limit int, remaining int) {
+	m.rateLimit.WithLabelValues(string(client)).Set(float64(limit))
+	m.rateLimitRemaining.WithLabelValues(string(client)).Set(float64(remaining))
+}
@@ -0,0 +1,61 @@
+package firiprom
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+func TestMetricsUseEndpointTemplates(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatalf("error creating metrics: %v", err)
+	}
+	status := 200
+	doer := func(r *http.Request) (*http.Response, error) {
+		h := http.Header{}
+		h.Set("X-RateLimit-Limit", "100")
+		h.Set("X-RateLimit-Remaining", "42")
+		return &http.Response{
+			StatusCode: status,
+			Header:     h,
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"market":"BTCNOK","bid":"1","ask":"2","spread":"1"}`))),
+		}, nil
+	}
+	base, _ := url.Parse("https://api.firi.com")
+	c := firiclient.New(base, doer, firiclient.WithMetrics(m))
+
+	ctx := context.Background()
+	c.GetMarketTickerV2(ctx, firiclient.BTCNOK)
+	c.GetMarketTickerV2(ctx, firiclient.ETHNOK)
+	status = 500
+	c.GetMarketTickerV2(ctx, firiclient.ETHNOK)
+
+	expected := `
+# HELP firi_requests_total Requests made to the Firi API.
+# TYPE firi_requests_total counter
+firi_requests_total{client="public",endpoint="/v2/markets/:market/ticker",method="GET",status_class="2xx"} 2
+firi_requests_total{client="public",endpoint="/v2/markets/:market/ticker",method="GET",status_class="5xx"} 1
+# HELP firi_request_errors_total Requests to the Firi API that failed or returned a 4xx/5xx status.
+# TYPE firi_request_errors_total counter
+firi_request_errors_total{client="public",endpoint="/v2/markets/:market/ticker",method="GET",status_class="5xx"} 1
+# HELP firi_ratelimit_remaining Requests left in the current rate limit window, as reported by the API.
+# TYPE firi_ratelimit_remaining gauge
+firi_ratelimit_remaining{client="public"} 42
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"firi_requests_total", "firi_request_errors_total", "firi_ratelimit_remaining")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,160 @@
+package firiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type serverTime struct {
+	Time time.Time
+}
+
+// UnmarshalJSON accepts {"time": ...} as unix seconds, unix milliseconds or an RFC3339 string.
+func (s *serverTime) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Time json.RawMessage `json:"time"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw.Time) == 0 {
+		return fmt.Errorf("json: missing server time in %s", b)
+	}
+	if raw.Time[0] == '"' {
+		var str string
+		if err := json.Unmarshal(raw.Time, &str); err != nil {
+			return err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+			s.Time = t
+			return nil
+		}
+		raw.Time = json.RawMessage(str)
+	}
+	n, err := strconv.ParseInt(string(raw.Time), 10, 64)
+	if err != nil {
+		return fmt.Errorf("json: invalid server time %s", raw.Time)
+	}
+	// anything past year 33658 in seconds is taken to be milliseconds
+	if n > 1e12 {
+		s.Time = time.UnixMilli(n)
+	} else {
+		s.Time = time.Unix(n, 0)
+	}
+	return nil
+}
+
+// GET /time
+func (c *publicClient) GetServerTime(ctx context.Context) (time.Time, error) {
+	m, err := call[serverTime](ctx, c, c.endpoint("GetServerTime", "GET", "/time"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return m.Time, nil
+}
+
+// DefaultMaxClockSkew is the clock skew tolerated by HealthCheck. Signed
+// requests are only valid for a short window, so a skewed clock makes them fail.
+const DefaultMaxClockSkew = time.Second
+
+type CheckResult struct {
+	Name    string        `json:"name"`
+	OK      bool          `json:"ok"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Healthy   bool          `json:"healthy"`
+	CheckedAt time.Time     `json:"checked_at"`
+	ClockSkew time.Duration `json:"clock_skew"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+func (r *HealthReport) add(res CheckResult) {
+	r.Checks = append(r.Checks, res)
+	if !res.OK {
+		r.Healthy = false
+	}
+}
+
+// HealthCheck verifies that the public API is reachable and that the local
+// clock is within DefaultMaxClockSkew of the server. Failed checks are
+// reported in the report, not as an error.
+func (c *publicClient) HealthCheck(ctx context.Context) *HealthReport {
+	report := &HealthReport{Healthy: true, CheckedAt: time.Now()}
+	c.checkPublic(ctx, report)
+	return report
+}
+
+// HealthCheck verifies public reachability and clock skew like the public
+// client, and that signed requests are accepted with a cheap signed call.
+func (c *authClient) HealthCheck(ctx context.Context) *HealthReport {
+	report := c.publicClient.HealthCheck(ctx)
+
+	start := time.Now()
+	_, err := c.GetBalancesV2(ctx)
+	report.add(checkResult("signature", time.Since(start), err))
+	return report
+}
+
+func (c *publicClient) checkPublic(ctx context.Context, report *HealthReport) {
+	start := time.Now()
+	server, err := c.GetServerTime(ctx)
+	latency := time.Since(start)
+	report.add(checkResult("public", latency, err))
+	if err != nil {
+		return
+	}
+
+	// compare with the local time halfway through the request
+	local := start.Add(latency / 2)
+	report.ClockSkew = local.Sub(server)
+	skew := report.ClockSkew
+	if skew < 0 {
+		skew = -skew
+	}
+	tolerance := DefaultMaxClockSkew
+	// a server time in whole seconds may be truncated by up to a second
+	if server.Nanosecond() == 0 {
+		tolerance += time.Second
+	}
+	res := CheckResult{Name: "clock_skew", OK: true}
+	if skew > tolerance {
+		res.OK = false
+		res.Error = fmt.Sprintf("local clock is off by %v", report.ClockSkew)
+	}
+	report.add(res)
+}
+
+func checkResult(name string, latency time.Duration, err error) CheckResult {
+	res := CheckResult{Name: name, OK: err == nil, Latency: latency}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// HealthChecker is implemented by both the public and authenticated clients.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) *HealthReport
+}
+
+// HealthHandler serves the health report as JSON, with status 200 when
+// healthy and 503 otherwise, for use as a Kubernetes readiness probe.
+func HealthHandler(c HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.HealthCheck(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if report.Healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,78 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerTimeFormats(t *testing.T) {
+	want := time.Unix(1632954488, 0)
+	for _, body := range []string{
+		`{"time":1632954488}`,
+		`{"time":1632954488000}`,
+		`{"time":"1632954488"}`,
+		`{"time":"2021-09-29T22:28:08Z"}`,
+	} {
+		var s serverTime
+		if err := json.Unmarshal([]byte(body), &s); err != nil {
+			t.Errorf("error parsing %v: %v", body, err)
+			continue
+		}
+		if !s.Time.Equal(want) {
+			t.Errorf("expected %v from %v, got %v", want, body, s.Time)
+		}
+	}
+	var s serverTime
+	if err := json.Unmarshal([]byte(`{}`), &s); err == nil {
+		t.Errorf("expected error for missing time")
+	}
+}
+
+// healthDoer answers /time with the given offset from the local clock and
+// every other request with the given status.
+func healthDoer(offset time.Duration, status int) Doer {
+	return func(r *http.Request) (*http.Response, error) {
+		body := "[]"
+		code := status
+		if r.URL.Path == "/time" {
+			body = fmt.Sprintf(`{"time":%d}`, time.Now().Add(offset).UnixMilli())
+			code = 200
+		}
+		return &http.Response{
+			StatusCode: code,
+			Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		}, nil
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	ctx := context.Background()
+
+	report := newTestAuthClient(healthDoer(0, 200)).HealthCheck(ctx)
+	if !report.Healthy || len(report.Checks) != 3 {
+		t.Errorf("expected healthy report with 3 checks, got %+v", report)
+	}
+
+	report = newTestAuthClient(healthDoer(10*time.Second, 200)).HealthCheck(ctx)
+	if report.Healthy || report.ClockSkew > -9*time.Second {
+		t.Errorf("expected unhealthy report from clock skew, got %+v", report)
+	}
+
+	report = newTestAuthClient(healthDoer(0, 401)).HealthCheck(ctx)
+	if report.Healthy || report.Checks[2].Name != "signature" || report.Checks[2].OK {
+		t.Errorf("expected failed signature check, got %+v", report)
+	}
+
+	rec := httptest.NewRecorder()
+	HealthHandler(newTestAuthClient(healthDoer(0, 401))).ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 from unhealthy handler, got %v", rec.Code)
+	}
+}
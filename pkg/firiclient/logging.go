@@ -0,0 +1,153 @@
+package firiclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelDisabled turns off logging of an event.
+	LevelDisabled
+)
+
+// LogEvent is a point in the lifecycle of a request that can be logged.
+type LogEvent string
+
+const (
+	// EventRequest is logged before a request is sent.
+	EventRequest LogEvent = "request"
+	// EventResponse is logged when a response has a 1xx-3xx status.
+	EventResponse LogEvent = "response"
+	// EventResponseStatus is logged when a response has a 4xx or 5xx status.
+	EventResponseStatus LogEvent = "response_status"
+	// EventTransportError is logged when a request fails without a response.
+	EventTransportError LogEvent = "transport_error"
+)
+
+// LogLevels sets the level each event is logged at.
+type LogLevels map[LogEvent]LogLevel
+
+// DefaultLogLevels logs every request and response, as the client always has.
+var DefaultLogLevels = LogLevels{
+	EventRequest:        LevelInfo,
+	EventResponse:       LevelInfo,
+	EventResponseStatus: LevelWarn,
+	EventTransportError: LevelError,
+}
+
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the log events of the client.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, fields ...LogField)
+}
+
+// WithLogger sends client logs to l instead of the zerolog logger in the request context.
+func WithLogger(l Logger) Option {
+	return func(c *publicClient) {
+		c.logger = l
+	}
+}
+
+// WithLogLevels overrides the level of the given events, keeping the defaults for the rest.
+func WithLogLevels(levels LogLevels) Option {
+	return func(c *publicClient) {
+		merged := LogLevels{}
+		for k, v := range c.logLevels {
+			merged[k] = v
+		}
+		for k, v := range levels {
+			merged[k] = v
+		}
+		c.logLevels = merged
+	}
+}
+
+// WithLogHeaders adds the request headers to the request event, with credentials redacted.
+func WithLogHeaders() Option {
+	return func(c *publicClient) {
+		c.logHeaders = true
+	}
+}
+
+func (c *publicClient) log(ctx context.Context, event LogEvent, msg string, fields ...LogField) {
+	level, ok := c.logLevels[event]
+	if !ok || level == LevelDisabled {
+		return
+	}
+	c.logger.Log(ctx, level, msg, fields...)
+}
+
+type zerologCtxLogger struct{}
+
+// ZerologCtxLogger logs to the zerolog logger of each request's context.
+// It is the default logger.
+func ZerologCtxLogger() Logger {
+	return zerologCtxLogger{}
+}
+
+func (zerologCtxLogger) Log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+	logZerolog(zerolog.Ctx(ctx), level, msg, fields)
+}
+
+type zerologLogger struct {
+	l zerolog.Logger
+}
+
+// NewZerologLogger logs to l regardless of the request context.
+func NewZerologLogger(l zerolog.Logger) Logger {
+	return &zerologLogger{l: l}
+}
+
+func (z *zerologLogger) Log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+	logZerolog(&z.l, level, msg, fields)
+}
+
+func logZerolog(l *zerolog.Logger, level LogLevel, msg string, fields []LogField) {
+	var ev *zerolog.Event
+	switch level {
+	case LevelDebug:
+		ev = l.Debug()
+	case LevelInfo:
+		ev = l.Info()
+	case LevelWarn:
+		ev = l.Warn()
+	default:
+		ev = l.Error()
+	}
+	for _, f := range fields {
+		switch v := f.Value.(type) {
+		case string:
+			ev = ev.Str(f.Key, v)
+		case int:
+			ev = ev.Int(f.Key, v)
+		case time.Duration:
+			ev = ev.Dur(f.Key, v)
+		case error:
+			ev = ev.AnErr(f.Key, v)
+		default:
+			ev = ev.Interface(f.Key, v)
+		}
+	}
+	ev.Msg(msg)
+}
+
+type nopLogger struct{}
+
+// NopLogger discards all logs.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {}
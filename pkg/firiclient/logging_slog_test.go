@@ -0,0 +1,95 @@
+//go:build go1.21
+
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type slogRecord struct {
+	level slog.Level
+	msg   string
+	attrs map[string]interface{}
+}
+
+// captureHandler keeps every record it handles.
+type captureHandler struct {
+	records []slogRecord
+}
+
+func (h *captureHandler) Enabled(ctx context.Context, level slog.Level) bool { return true }
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler           { return h }
+func (h *captureHandler) WithGroup(name string) slog.Handler                 { return h }
+
+func (h *captureHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := map[string]interface{}{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.Any()
+		return true
+	})
+	h.records = append(h.records, slogRecord{level: r.Level, msg: r.Message, attrs: attrs})
+	return nil
+}
+
+func TestSlogLoggerLevels(t *testing.T) {
+	h := &captureHandler{}
+	l := NewSlogLogger(slog.New(h))
+	ctx := context.Background()
+	for _, c := range []struct {
+		level LogLevel
+		want  slog.Level
+	}{
+		{LevelDebug, slog.LevelDebug},
+		{LevelInfo, slog.LevelInfo},
+		{LevelWarn, slog.LevelWarn},
+		{LevelError, slog.LevelError},
+	} {
+		h.records = nil
+		l.Log(ctx, c.level, "msg", LogField{Key: "status", Value: 200})
+		if len(h.records) != 1 {
+			t.Fatalf("expected 1 record for %v, got %v", c.level, len(h.records))
+		}
+		r := h.records[0]
+		if r.level != c.want || r.msg != "msg" {
+			t.Errorf("expected %v msg, got %v %v", c.want, r.level, r.msg)
+		}
+		if r.attrs["status"] != int64(200) {
+			t.Errorf("expected status=200, got %+v", r.attrs)
+		}
+	}
+}
+
+func TestSlogLoggerLogsRequests(t *testing.T) {
+	doer := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Body:       io.NopCloser(bytes.NewReader([]byte(`[]`))),
+		}, nil
+	}
+	h := &captureHandler{}
+	base, _ := url.Parse("https://api.firi.com")
+	c := New(base, doer,
+		WithLogger(NewSlogLogger(slog.New(h))),
+		WithLogLevels(LogLevels{EventResponse: LevelDebug}),
+	)
+	if _, err := c.GetMarketsV2(context.Background()); err != nil {
+		t.Fatalf("error getting markets: %v", err)
+	}
+	if len(h.records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", h.records)
+	}
+	req, res := h.records[0], h.records[1]
+	if req.level != slog.LevelInfo || res.level != slog.LevelDebug {
+		t.Errorf("unexpected levels request=%v response=%v", req.level, res.level)
+	}
+	if req.attrs["uri"] != "https://api.firi.com/v2/markets" {
+		t.Errorf("expected the request uri as a field, got %+v", req.attrs)
+	}
+}
@@ -0,0 +1,87 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type logEntry struct {
+	level  LogLevel
+	msg    string
+	fields map[string]interface{}
+}
+
+type captureLogger struct {
+	entries []logEntry
+}
+
+func (c *captureLogger) Log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+	m := map[string]interface{}{}
+	for _, f := range fields {
+		m[f.Key] = f.Value
+	}
+	c.entries = append(c.entries, logEntry{level: level, msg: msg, fields: m})
+}
+
+func TestLoggerRedactsSignedRequests(t *testing.T) {
+	doer := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Body:       io.NopCloser(bytes.NewReader([]byte(`[]`))),
+		}, nil
+	}
+	logger := &captureLogger{}
+	base, _ := url.Parse("https://api.firi.com")
+	public := New(base, doer,
+		WithLogger(logger),
+		WithLogHeaders(),
+		WithLogLevels(LogLevels{EventResponse: LevelDebug}),
+	)
+	c := NewAuthenticatedClient(base, NewSigner("client", "key", secretKey), public, doer)
+
+	_, err := c.GetActiveOrders(context.Background())
+	if err != nil {
+		t.Fatalf("error getting orders: %v", err)
+	}
+	if len(logger.entries) != 2 {
+		t.Fatalf("expected 2 log entries, got %v", len(logger.entries))
+	}
+	req, res := logger.entries[0], logger.entries[1]
+	if req.level != LevelInfo || res.level != LevelDebug {
+		t.Errorf("unexpected levels request=%v response=%v", req.level, res.level)
+	}
+	uri := req.fields["uri"].(string)
+	if !strings.Contains(uri, "timestamp="+redacted) || !strings.Contains(uri, "validity="+redacted) {
+		t.Errorf("expected signed query params to be redacted, got uri=%v", uri)
+	}
+	headers := req.fields["headers"].(map[string]string)
+	for _, h := range []string{"Miraiex-Access-Key", "Miraiex-User-Signature", "Miraiex-User-Clientid"} {
+		if headers[h] != redacted {
+			t.Errorf("expected header %v to be redacted, got %v", h, headers[h])
+		}
+	}
+}
+
+func TestLogLevelDisabled(t *testing.T) {
+	doer := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader([]byte(`[]`)))}, nil
+	}
+	logger := &captureLogger{}
+	base, _ := url.Parse("https://api.firi.com")
+	c := New(base, doer, WithLogger(logger), WithLogLevels(LogLevels{
+		EventRequest:  LevelDisabled,
+		EventResponse: LevelDisabled,
+	}))
+	if _, err := c.GetMarketsV2(context.Background()); err != nil {
+		t.Fatalf("error getting markets: %v", err)
+	}
+	if len(logger.entries) != 0 {
+		t.Errorf("expected no log entries, got %+v", logger.entries)
+	}
+}
@@ -0,0 +1,120 @@
+package firiclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ClientType string
+
+const (
+	ClientPublic  ClientType = "public"
+	ClientPrivate ClientType = "private"
+)
+
+// RequestInfo describes one completed request.
+type RequestInfo struct {
+	Client ClientType
+	Method string
+	// Endpoint is the route template, e.g. /v2/markets/:market/ticker,
+	// so market ids and query parameters do not explode label cardinality.
+	Endpoint string
+	// Status is 0 and StatusClass "error" if the request failed without a response.
+	Status      int
+	StatusClass string
+	Duration    time.Duration
+	Err         error
+}
+
+// Metrics receives measurements for requests made by the client.
+type Metrics interface {
+	ObserveRequest(info RequestInfo)
+	// SetRateLimit is called when a response carries rate limit headers.
+	SetRateLimit(client ClientType, limit int, remaining int)
+}
+
+// endpoints are the route templates of the API, matched segment by segment
+// where a segment starting with ':' matches anything.
+var endpoints = []string{
+	"/time",
+	"/v1/markets",
+	"/v2/markets",
+	"/v2/markets/tickers",
+	"/v2/markets/:market/ticker",
+	"/v2/markets/:market/history",
+	"/v2/markets/:market/depth",
+	"/v2/orders",
+	"/v2/orders/history",
+	"/v2/orders/:market",
+	"/v2/orders/:id/:market/detailed",
+	"/v2/history/trades",
+	"/v2/withdraw/:coin",
+	"/v2/balances",
+}
+
+// EndpointTemplate returns the route template matching path, or "other".
+func EndpointTemplate(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	// exact routes take precedence over templated ones, e.g. /v2/orders/history
+	best := ""
+	bestWildcards := -1
+	for _, e := range endpoints {
+		parts := strings.Split(strings.Trim(e, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		wildcards := 0
+		match := true
+		for i, p := range parts {
+			if strings.HasPrefix(p, ":") {
+				wildcards++
+				continue
+			}
+			if p != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match && (bestWildcards == -1 || wildcards < bestWildcards) {
+			best = e
+			bestWildcards = wildcards
+		}
+	}
+	if best == "" {
+		return "other"
+	}
+	return best
+}
+
+func statusClass(status int) string {
+	if status <= 0 {
+		return "error"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func (c *publicClient) observe(client ClientType, r *http.Request, res *http.Response, elapsed time.Duration, err error) {
+	if c.metrics == nil {
+		return
+	}
+	info := RequestInfo{
+		Client:      client,
+		Method:      r.Method,
+		Endpoint:    EndpointTemplate(r.URL.Path),
+		StatusClass: statusClass(0),
+		Duration:    elapsed,
+		Err:         err,
+	}
+	if res != nil {
+		info.Status = res.StatusCode
+		info.StatusClass = statusClass(res.StatusCode)
+		limit, lerr := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+		remaining, rerr := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+		if lerr == nil && rerr == nil {
+			c.metrics.SetRateLimit(client, limit, remaining)
+		}
+	}
+	c.metrics.ObserveRequest(info)
+}
@@ -0,0 +1,19 @@
+package firiclient
+
+import "testing"
+
+func TestEndpointTemplate(t *testing.T) {
+	cases := map[string]string{
+		"/v2/markets/BTCNOK/ticker": "/v2/markets/:market/ticker",
+		"/v2/markets/tickers":       "/v2/markets/tickers",
+		"/v2/orders/history":        "/v2/orders/history",
+		"/v2/orders/ETHNOK":         "/v2/orders/:market",
+		"/v2/withdraw/BTC":          "/v2/withdraw/:coin",
+		"/v3/unknown":               "other",
+	}
+	for path, expected := range cases {
+		if got := EndpointTemplate(path); got != expected {
+			t.Errorf("path=%v: expected=%v got=%v", path, expected, got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package firiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// roundTrip checks that a model decoded from data encodes to a stable form:
+// decoding and encoding the encoded form again must give the same bytes.
+// Inputs that do not decode are out of scope. A decoded model with NaN or
+// infinite floats, which JSON cannot represent, must fail to encode with an
+// UnsupportedValueError.
+func roundTrip[T any](t *testing.T, data []byte) {
+	var first T
+	if err := json.Unmarshal(data, &first); err != nil {
+		return
+	}
+	out, err := json.Marshal(first)
+	if !finiteFloats(reflect.ValueOf(first)) {
+		unsupported := &json.UnsupportedValueError{}
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("expected UnsupportedValueError encoding %T decoded from %q, got out=%s err=%v", first, data, out, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("error encoding %T decoded from %q: %v", first, data, err)
+	}
+	var second T
+	if err := json.Unmarshal(out, &second); err != nil {
+		t.Fatalf("error decoding %T from its own encoding %s: %v", second, out, err)
+	}
+	again, err := json.Marshal(second)
+	if err != nil {
+		t.Fatalf("error re-encoding %T: %v", second, err)
+	}
+	if !bytes.Equal(out, again) {
+		t.Fatalf("unstable round trip for %T:\n%s\n%s", first, out, again)
+	}
+}
+
+// finiteFloats reports whether every float in v is finite.
+func finiteFloats(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return !math.IsNaN(v.Float()) && !math.IsInf(v.Float(), 0)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !finiteFloats(v.Field(i)) {
+				return false
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !finiteFloats(v.Index(i)) {
+				return false
+			}
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return finiteFloats(v.Elem())
+		}
+	}
+	return true
+}
+
+func fuzzRoundTrip[T any](f *testing.F, seeds ...string) {
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		roundTrip[T](t, data)
+	})
+}
+
+var (
+	marketSeed        = `{"id":"BTCNOK","last":"300000.5","high":"310000","change":"-1.5","low":"290000","volume":"12.34"}`
+	tickerSeed        = `{"market":"BTCNOK","bid":"299000","ask":"301000","spread":"2000"}`
+	balanceSeed       = `{"currency":"BTC","balance":"1.5","hold":"0.5","available":"1"}`
+	historicOrderSeed = `{"type":"bid","amount":"0.01","price":"300000","total":"3000","created_at":"2023-10-01T12:00:00.123Z"}`
+	activeOrderSeed   = `{"id":123,"market":"BTCNOK","type":"ask","price":"300000","amount":"1","remaining":"0.5","matched":"0.5","cancelled":"0","created_at":"2023-10-01T12:00:00+02:00"}`
+	historicTradeSeed = `{"id":"abc","market":"BTCNOK","price":"300000","price_currency":"NOK","amount":"0.1","amount_currency":"BTC","cost":"30000","cost_currency":"NOK","side":"bid","isMaker":true,"date":"2023-10-01T12:00:00Z"}`
+	createOrderSeed   = `{"market":"BTCNOK","type":"bid","price":"300000","amount":"0.001"}`
+	withdrawalSeed    = `{"amount":"0.1","address":"bc1qxyz"}`
+)
+
+// TestModelsRoundTrip runs the round trip property on a realistic payload of
+// every request and response model.
+func TestModelsRoundTrip(t *testing.T) {
+	roundTrip[Markets](t, []byte("["+marketSeed+"]"))
+	roundTrip[MarketTickers](t, []byte("["+tickerSeed+"]"))
+	roundTrip[Balances](t, []byte("["+balanceSeed+"]"))
+	roundTrip[TradeHistory](t, []byte("["+historicOrderSeed+"]"))
+	roundTrip[ActiveOrders](t, []byte("["+activeOrderSeed+"]"))
+	roundTrip[HistoricTrades](t, []byte("["+historicTradeSeed+"]"))
+	roundTrip[CreateOrderRequest](t, []byte(createOrderSeed))
+	roundTrip[CreateOrderResponse](t, []byte(`{"id":42}`))
+	roundTrip[CreateWithdrawalRequest](t, []byte(withdrawalSeed))
+	roundTrip[CreateWithdrawalResponse](t, []byte(`{}`))
+	roundTrip[Orderbook](t, []byte(`{"bids":[["1","2"]],"asks":[[3,4]]}`))
+}
+
+func FuzzOrderTypeUnmarshal(f *testing.F) {
+	for _, s := range []string{`"bid"`, `"ask"`, `"BID"`, `""`, `1`, `null`, `"b\u0069d"`} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var o OrderType
+		if err := json.Unmarshal(data, &o); err != nil {
+			return
+		}
+		// null is the only encoding of a missing order type
+		if o == "" && string(bytes.TrimSpace(data)) == "null" {
+			return
+		}
+		if o != Bid && o != Ask {
+			t.Fatalf("decoded invalid order type=%q from %q", o, data)
+		}
+		roundTrip[OrderType](t, data)
+	})
+}
+
+func TestInvalidOrderTypeDoesNotEncode(t *testing.T) {
+	if out, err := json.Marshal(CreateOrderRequest{Type: "sell"}); err == nil {
+		t.Errorf("expected an error encoding an invalid order type, got %s", out)
+	}
+}
+
+func FuzzMarket(f *testing.F) {
+	fuzzRoundTrip[Market](f, marketSeed, `{"last":"1e308"}`, `{"last":"0x1p-2"}`, `{"last":" 1"}`, `{"volume":"-0"}`)
+}
+
+func FuzzMarketTicker(f *testing.F) {
+	fuzzRoundTrip[MarketTicker](f, tickerSeed, `{"bid":"NaN"}`, `{"ask":"Inf"}`)
+}
+
+func FuzzBalance(f *testing.F) {
+	fuzzRoundTrip[Balance](f, balanceSeed, `{"balance":1}`, `{"hold":"1_000"}`)
+}
+
+func FuzzHistoricOrder(f *testing.F) {
+	fuzzRoundTrip[HistoricOrder](f, historicOrderSeed,
+		`{"created_at":"2023-10-01T12:00:00+23:59"}`,
+		`{"created_at":"0000-01-01T00:00:00Z"}`,
+		`{"created_at":"2023-10-01 12:00:00"}`,
+		`{"type":"sell"}`,
+		`{"type":null}`,
+	)
+}
+
+func FuzzActiveOrder(f *testing.F) {
+	fuzzRoundTrip[ActiveOrder](f, activeOrderSeed, `{"id":1e3}`, `{"id":"1"}`, `{"remaining":"1e-400"}`)
+}
+
+func FuzzHistoricTrade(f *testing.F) {
+	fuzzRoundTrip[HistoricTrade](f, historicTradeSeed,
+		`{"date":"2023-10-01T12:00:00.999999999-11:30"}`,
+		`{"isMaker":"true"}`,
+		`{"cost":"\u0031"}`,
+	)
+}
+
+func FuzzCreateOrderRequest(f *testing.F) {
+	fuzzRoundTrip[CreateOrderRequest](f, createOrderSeed, `{"price":"1.0000000000000002"}`)
+}
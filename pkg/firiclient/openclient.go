@@ -5,14 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rs/xid"
-	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OrderType string
@@ -27,11 +27,23 @@ var orderTypes = map[string]OrderType{
 	"ask": Ask,
 }
 
+// MarshalJSON encodes a missing order type as null, and fails for anything
+// else but a bid or an ask, like UnmarshalJSON.
 func (o OrderType) MarshalJSON() ([]byte, error) {
+	if o == "" {
+		return []byte("null"), nil
+	}
+	if _, ok := orderTypes[string(o)]; !ok {
+		return nil, errors.New("json: invalid orderType value=" + string(o))
+	}
 	return json.Marshal(string(o))
 }
 
 func (o *OrderType) UnmarshalJSON(b []byte) error {
+	// null is a missing order type, as encoded by MarshalJSON
+	if string(b) == "null" {
+		return nil
+	}
 	var s string
 	err := json.Unmarshal(b, &s)
 	if err != nil {
@@ -58,16 +70,38 @@ const (
 
 type Doer func(*http.Request) (*http.Response, error)
 
-func New(base *url.URL, httpClient Doer) *publicClient {
-	return &publicClient{
-		baseurl: base,
-		doer:    httpClient,
-	}
+func New(base *url.URL, httpClient Doer, opts ...Option) *publicClient {
+	c := &publicClient{
+		baseurl:     base,
+		doer:        httpClient,
+		tracer:      trace.NewNoopTracerProvider().Tracer(instrumentationName),
+		logger:      ZerologCtxLogger(),
+		logLevels:   DefaultLogLevels,
+		redact:      NewRedactionPolicy(),
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 type publicClient struct {
 	baseurl *url.URL
 	doer    Doer
+	metrics Metrics
+	tracer  trace.Tracer
+
+	logger     Logger
+	logLevels  LogLevels
+	logHeaders bool
+
+	redact *RedactionPolicy
+	dump   io.Writer
+	dumpMu sync.Mutex
+
+	maxBodySize int64
+	limiter     RateLimiter
 }
 
 type Markets []Market
@@ -82,58 +116,12 @@ type Market struct {
 
 // GET /v1/markets
 func (c *publicClient) GetMarketsV1(ctx context.Context) (Markets, error) {
-	uri, err := c.baseurl.Parse("/v1/markets")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := Markets{}
-		err = json.Unmarshal(body, &m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return call[Markets](ctx, c, c.endpoint("GetMarketsV1", "GET", "/v1/markets"))
 }
 
 // GET /v2/markets
 func (c *publicClient) GetMarketsV2(ctx context.Context) (Markets, error) {
-	uri, err := c.baseurl.Parse("/v2/markets")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := Markets{}
-		err = json.Unmarshal(body, &m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return call[Markets](ctx, c, c.endpoint("GetMarketsV2", "GET", "/v2/markets"))
 }
 
 type MarketTickers []MarketTicker
@@ -146,108 +134,37 @@ type MarketTicker struct {
 
 // GET /v2/markets/tickers
 func (c *publicClient) GetMarketTickersV2(ctx context.Context) (MarketTickers, error) {
-	uri, err := c.baseurl.Parse("/v2/markets/tickers")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := MarketTickers{}
-		err = json.Unmarshal(body, &m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return call[MarketTickers](ctx, c, c.endpoint("GetMarketTickersV2", "GET", "/v2/markets/tickers"))
 }
 
 // GET /v2/markets/:market/ticker
 func (c *publicClient) GetMarketTickerV2(ctx context.Context, marketId MarketID) (*MarketTicker, error) {
-	uri, err := c.baseurl.Parse("/v2/markets/" + string(marketId) + "/ticker")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	m, err := call[MarketTicker](ctx, c, c.endpoint("GetMarketTickerV2", "GET", "/v2/markets/"+string(marketId)+"/ticker"))
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 200 {
-		m := MarketTicker{}
-		err = json.Unmarshal(body, &m)
+	if m.MarketID == "" {
 		m.MarketID = string(marketId)
-		return &m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
 	}
+	return &m, nil
 }
 
 type Balances []Balance
+
+// Balance is the balance of a currency as returned by GET /v2/balances.
 type Balance struct {
-	MarketID string  `json:"id"`
-	Last     float64 `json:"last,string"`
-	High     float64 `json:"high,string"`
-	Low      float64 `json:"low,string"`
-	Change   float64 `json:"change,string"`
-	Volume   float64 `json:"volume,string"`
+	Currency  string  `json:"currency"`
+	Balance   float64 `json:"balance,string"`
+	Hold      float64 `json:"hold,string"`
+	Available float64 `json:"available,string"`
 }
 
-type Bids []ordersJsonList
-type Asks []ordersJsonList
-
-// ordersJsonList: a order is a list of ["price", "quantity"], both float64 as string
-type ordersJsonList []interface{}
-
-func (s ordersJsonList) ToOrder() (Order, bool) {
-	o := Order{}
-	if len(s) != 2 {
-		return o, false
-	}
-	priceStr := s[0].(string)
-	quantityStr := s[1].(string)
-	price, err := strconv.ParseFloat(priceStr, 64)
-	if err != nil {
-		return o, false
-	}
-	quantity, err := strconv.ParseFloat(quantityStr, 64)
-	if err != nil {
-		return o, false
-	}
-	o.Price = price
-	o.Quantity = quantity
-	return o, true
-}
+// Order is a level of an orderbook.
+type Order = PriceLevel
 
-type Order struct {
-	Price    float64
-	Quantity float64
-}
 type Orderbook struct {
-	Bids []Order
-	Asks []Order
-}
-type orderbookJson struct {
-	Bids Bids `json:"bids"`
-	Asks Asks `json:"asks"`
+	Bids PriceLevels `json:"bids"`
+	Asks PriceLevels `json:"asks"`
 }
 
 type TradeHistory []HistoricOrder
@@ -260,126 +177,80 @@ type HistoricOrder struct {
 }
 
 // GET /v2/markets/:market/history
-func (c *publicClient) GetMarketTradeHistoryV2(ctx context.Context, marketId MarketID) (*TradeHistory, error) {
-	uri, err := c.baseurl.Parse("/v2/markets/" + string(marketId) + "/history")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := &TradeHistory{}
-		err = json.Unmarshal(body, m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+func (c *publicClient) GetMarketTradeHistoryV2(ctx context.Context, marketId MarketID) (TradeHistory, error) {
+	return call[TradeHistory](ctx, c, c.endpoint("GetMarketTradeHistoryV2", "GET", "/v2/markets/"+string(marketId)+"/history"))
 }
 
 // GET /v2/markets/:market/depth
 func (c *publicClient) GetOrderbookV2(ctx context.Context, marketId MarketID) (*Orderbook, error) {
-	uri, err := c.baseurl.Parse("/v2/markets/" + string(marketId) + "/depth")
+	m, err := call[Orderbook](ctx, c, c.endpoint("GetOrderbookV2", "GET", "/v2/markets/"+string(marketId)+"/depth"))
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := orderbookJson{}
-		err = json.Unmarshal(body, &m)
-		if err != nil {
-			return nil, err
-		}
-		bids := make([]Order, len(m.Bids))
-		asks := make([]Order, len(m.Asks))
-
-		for i := range m.Bids {
-			o, ok := m.Bids[i].ToOrder()
-			if !ok {
-				return nil, fmt.Errorf("error parsing val=%+v", m.Bids[i])
-			}
-			bids[i] = o
-		}
-		for i := range m.Asks {
-			o, ok := m.Asks[i].ToOrder()
-			if !ok {
-				return nil, fmt.Errorf("error parsing val=%+v", m.Asks[i])
-			}
-			asks[i] = o
-		}
-		o := &Orderbook{
-			Bids: bids,
-			Asks: asks,
-		}
-		return o, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return &m, nil
 }
 
 func (c *publicClient) do(r *http.Request) (*http.Response, error) {
-	log := zerolog.Ctx(r.Context())
-	start := time.Now()
-	uri := r.URL.String()
+	return c.roundTrip(r, ClientPublic)
+}
+
+func (c *publicClient) wait(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	return c.limiter.Wait(ctx)
+}
+
+func (c *publicClient) roundTrip(r *http.Request, client ClientType) (*http.Response, error) {
+	ctx := r.Context()
+	uri := c.redact.URL(r.URL)
 	if r.Header.Get("x-request-id") == "" {
 		xId := xid.New().String()
 		r.Header.Set("x-request-id", xId)
 	}
 	xId := r.Header.Get("x-request-id")
-	log.Info().Str("method", r.Method).Str("uri", uri).Str("x-request-id", xId).Msgf("%v: %v -->", r.Method, uri)
+	// signed requests wait in doSigned, before their signature starts to expire
+	if client != ClientPrivate {
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// start after waiting, like signed requests, so latency leaves out the limiter
+	start := time.Now()
+	fields := []LogField{{"method", r.Method}, {"uri", uri}, {"x-request-id", xId}}
+	if c.logHeaders {
+		fields = append(fields, LogField{"headers", flattenHeader(c.redact.Header(r.Header))})
+	}
+	c.log(ctx, EventRequest, fmt.Sprintf("%v: %v -->", r.Method, uri), fields...)
 
+	c.dumpRequest(r)
+	span := c.startHTTPSpan(r, client, xId)
 	res, err := c.doer(r)
 	elapsed := time.Since(start)
+	err = c.redact.Error(err)
+	c.dumpResponse(res)
+	endHTTPSpan(span, res, err)
+	c.observe(client, r, res, elapsed, err)
 	if err != nil {
-		log.Error().
-			Err(err).
-			Str("method", r.Method).
-			Str("uri", uri).
-			Dur("elapsed", elapsed).
-			Str("x-request-id", xId).
-			Msgf("%v: %v <-- ERROR: %v", r.Method, uri, err)
+		c.log(ctx, EventTransportError, fmt.Sprintf("%v: %v <-- ERROR: %v", r.Method, uri, err),
+			LogField{"error", err},
+			LogField{"method", r.Method},
+			LogField{"uri", uri},
+			LogField{"elapsed", elapsed},
+			LogField{"x-request-id", xId},
+		)
 		return res, err
-	} else {
-		if res.StatusCode > 300 {
-			log.Warn().
-				Str("method", r.Method).
-				Str("uri", uri).
-				Int("status", res.StatusCode).
-				Dur("elapsed", elapsed).
-				Str("x-request-id", xId).
-				Msgf("%v: %v <-- %v in %vms", r.Method, uri, res.Status, elapsed.Milliseconds())
-			return res, err
-		} else {
-			log.Info().
-				Str("method", r.Method).
-				Str("uri", uri).
-				Int("status", res.StatusCode).
-				Dur("elapsed", elapsed).
-				Str("x-request-id", xId).
-				Msgf("%v: %v <-- %v in %vms", r.Method, uri, res.Status, elapsed.Milliseconds())
-			return res, err
-		}
 	}
+	event := EventResponse
+	if res.StatusCode >= 400 {
+		event = EventResponseStatus
+	}
+	c.log(ctx, event, fmt.Sprintf("%v: %v <-- %v in %vms", r.Method, uri, res.Status, elapsed.Milliseconds()),
+		LogField{"method", r.Method},
+		LogField{"uri", uri},
+		LogField{"status", res.StatusCode},
+		LogField{"elapsed", elapsed},
+		LogField{"x-request-id", xId},
+	)
+	return res, err
 }
@@ -0,0 +1,12 @@
+package firiclient
+
+// Option configures optional behaviour of the client. Options given to New
+// also apply to an authenticated client built on top of it.
+type Option func(c *publicClient)
+
+// WithMetrics reports every request to m.
+func WithMetrics(m Metrics) Option {
+	return func(c *publicClient) {
+		c.metrics = m
+	}
+}
@@ -0,0 +1,140 @@
+package firiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// PriceLevel is a price and the quantity available at it. The API sends a
+// level as ["price", "quantity"]; both strings and JSON numbers are accepted.
+type PriceLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+func (l PriceLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]string{
+		strconv.FormatFloat(l.Price, 'f', -1, 64),
+		strconv.FormatFloat(l.Quantity, 'f', -1, 64),
+	})
+}
+
+func (l *PriceLevel) UnmarshalJSON(b []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return fmt.Errorf("expected [price, quantity]: %w", err)
+	}
+	if len(parts) != 2 {
+		return fmt.Errorf("expected [price, quantity], got %d elements", len(parts))
+	}
+	price, err := parseJsonFloat(parts[0])
+	if err != nil {
+		return fmt.Errorf("price: %w", err)
+	}
+	quantity, err := parseJsonFloat(parts[1])
+	if err != nil {
+		return fmt.Errorf("quantity: %w", err)
+	}
+	l.Price = price
+	l.Quantity = quantity
+	return nil
+}
+
+// parseJsonFloat parses a finite float sent as a JSON string or number.
+func parseJsonFloat(raw json.RawMessage) (float64, error) {
+	raw = bytes.TrimSpace(raw)
+	s := string(raw)
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, err
+		}
+	} else if len(raw) == 0 || (raw[0] != '-' && (raw[0] < '0' || raw[0] > '9')) {
+		return 0, fmt.Errorf("expected string or number, got %s", raw)
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return v, nil
+}
+
+// PriceLevels is one side of an orderbook, best price first.
+type PriceLevels []PriceLevel
+
+func (p *PriceLevels) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*p = nil
+		return nil
+	}
+	levels := make(PriceLevels, len(raw))
+	for i := range raw {
+		if err := levels[i].UnmarshalJSON(raw[i]); err != nil {
+			return &PriceLevelError{Index: i, Err: err}
+		}
+	}
+	*p = levels
+	return nil
+}
+
+// PriceLevelError reports which level of an orderbook failed to parse.
+type PriceLevelError struct {
+	Side  string
+	Index int
+	Err   error
+}
+
+func (e *PriceLevelError) Error() string {
+	side := e.Side
+	if side == "" {
+		side = "levels"
+	}
+	return fmt.Sprintf("firiclient: orderbook %s[%d]: %v", side, e.Index, e.Err)
+}
+
+func (e *PriceLevelError) Unwrap() error {
+	return e.Err
+}
+
+func (o *Orderbook) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Bids json.RawMessage `json:"bids"`
+		Asks json.RawMessage `json:"asks"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	res := Orderbook{}
+	if err := decodeSide(raw.Bids, "bids", &res.Bids); err != nil {
+		return err
+	}
+	if err := decodeSide(raw.Asks, "asks", &res.Asks); err != nil {
+		return err
+	}
+	*o = res
+	return nil
+}
+
+func decodeSide(raw json.RawMessage, side string, levels *PriceLevels) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	err := levels.UnmarshalJSON(raw)
+	if lerr, ok := err.(*PriceLevelError); ok {
+		lerr.Side = side
+		return lerr
+	}
+	if err != nil {
+		return fmt.Errorf("firiclient: orderbook %s: %w", side, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package firiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderbookUnmarshal(t *testing.T) {
+	ob := Orderbook{}
+	err := json.Unmarshal([]byte(`{"bids":[["100.5","1"],[99,2.5]],"asks":[["101", 0.1]]}`), &ob)
+	if err != nil {
+		t.Fatalf("error decoding orderbook: %v", err)
+	}
+	expected := Orderbook{
+		Bids: PriceLevels{{Price: 100.5, Quantity: 1}, {Price: 99, Quantity: 2.5}},
+		Asks: PriceLevels{{Price: 101, Quantity: 0.1}},
+	}
+	if !reflect.DeepEqual(ob, expected) {
+		t.Errorf("unexpected orderbook=%+v", ob)
+	}
+}
+
+func TestOrderbookUnmarshalErrors(t *testing.T) {
+	cases := map[string]string{
+		`{"bids":[["1","1"],[true,"1"]]}`:   "orderbook bids[1]: price",
+		`{"asks":[["1","x"]]}`:              "orderbook asks[0]: quantity",
+		`{"asks":[["1"]]}`:                  "orderbook asks[0]: expected [price, quantity], got 1 elements",
+		`{"bids":[["1","1","1"]]}`:          "got 3 elements",
+		`{"bids":[{"price":"1"}]}`:          "orderbook bids[0]: expected [price, quantity]",
+		`{"bids":[["NaN","1"]]}`:            "invalid number",
+		`{"bids":[[null,"1"]]}`:             "expected string or number",
+		`{"bids":{"price":"1"}}`:            "orderbook bids",
+		`{"asks":[["1","1"]],"bids":[[1]]}`: "orderbook bids[0]",
+	}
+	for input, expected := range cases {
+		ob := Orderbook{}
+		err := json.Unmarshal([]byte(input), &ob)
+		if err == nil {
+			t.Errorf("input=%v: expected error", input)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("input=%v: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+
+	err := json.Unmarshal([]byte(`{"asks":[["1","1"],["1",{}]]}`), &Orderbook{})
+	lerr := &PriceLevelError{}
+	if !errors.As(err, &lerr) || lerr.Side != "asks" || lerr.Index != 1 {
+		t.Errorf("expected PriceLevelError for asks[1], got %v", err)
+	}
+}
+
+func FuzzOrderbookUnmarshal(f *testing.F) {
+	seeds := []string{
+		`{"bids":[["100.5","1"]],"asks":[["101","2"]]}`,
+		`{"bids":[[100.5,1]],"asks":[]}`,
+		`{"bids":[["1e3","-0"]]}`,
+		`{"bids":[[1,2,3]]}`,
+		`{"bids":[["1"]]}`,
+		`{"asks":[[null,null]]}`,
+		`{"asks":[[{},[]]]}`,
+		`{"bids":null,"asks":null}`,
+		`{"bids":"x"}`,
+		`[]`,
+	}
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ob := Orderbook{}
+		if err := json.Unmarshal(data, &ob); err != nil {
+			return
+		}
+		for _, side := range []PriceLevels{ob.Bids, ob.Asks} {
+			for _, l := range side {
+				if math.IsNaN(l.Price) || math.IsInf(l.Price, 0) || math.IsNaN(l.Quantity) || math.IsInf(l.Quantity, 0) {
+					t.Fatalf("decoded non-finite level=%+v from %q", l, data)
+				}
+			}
+		}
+		out, err := json.Marshal(ob)
+		if err != nil {
+			t.Fatalf("error encoding decoded orderbook: %v", err)
+		}
+		again := Orderbook{}
+		if err := json.Unmarshal(out, &again); err != nil {
+			t.Fatalf("error decoding re-encoded orderbook %s: %v", out, err)
+		}
+		if !reflect.DeepEqual(normalize(ob), normalize(again)) {
+			t.Fatalf("round trip mismatch: %+v != %+v", ob, again)
+		}
+	})
+}
+
+// normalize treats empty and nil sides alike, as both encode to null or [].
+func normalize(o Orderbook) Orderbook {
+	if len(o.Bids) == 0 {
+		o.Bids = nil
+	}
+	if len(o.Asks) == 0 {
+		o.Asks = nil
+	}
+	return o
+}
@@ -1,11 +1,7 @@
 package firiclient
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -13,6 +9,9 @@ import (
 )
 
 func NewAuthenticatedClient(base *url.URL, s *signer, publicClient *publicClient, doer Doer) *authClient {
+	// the policy may be shared with other clients, which must not learn the key
+	publicClient.redact = publicClient.redact.Clone()
+	publicClient.redact.AddSecret(s.apiKey)
 	return &authClient{
 		publicClient: publicClient,
 		baseurl:      base,
@@ -44,58 +43,12 @@ type ActiveOrders []ActiveOrder
 
 // GET /v2/orders
 func (c *authClient) GetActiveOrders(ctx context.Context) (ActiveOrders, error) {
-	uri, err := c.baseurl.Parse("/v2/orders")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := ActiveOrders{}
-		err = json.Unmarshal(body, &m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return call[ActiveOrders](ctx, c.publicClient, c.endpoint("GetActiveOrders", "GET", "/v2/orders"))
 }
 
 // GET /v2/orders/history
 func (c *authClient) GetAllFilledAndClosedOrders(ctx context.Context) (ActiveOrders, error) {
-	uri, err := c.baseurl.Parse("/v2/orders/history")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := ActiveOrders{}
-		err = json.Unmarshal(body, &m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return call[ActiveOrders](ctx, c.publicClient, c.endpoint("GetAllFilledAndClosedOrders", "GET", "/v2/orders/history"))
 }
 
 type HistoricTrade struct {
@@ -116,86 +69,39 @@ type HistoricTrades []HistoricTrade
 
 // GET /v2/history/trades
 func (c *authClient) GetAllTrades(ctx context.Context) (HistoricTrades, error) {
-	uri, err := c.baseurl.Parse("/v2/history/trades")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := HistoricTrades{}
-		err = json.Unmarshal(body, &m)
-		return m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return call[HistoricTrades](ctx, c.publicClient, c.endpoint("GetAllTrades", "GET", "/v2/history/trades"))
+}
+
+// GET /v2/history/trades
+//
+// StreamAllTrades is like GetAllTrades, but decodes and hands trades to fn one
+// at a time instead of holding the full history in memory. Returning an error
+// from fn stops the stream.
+func (c *authClient) StreamAllTrades(ctx context.Context, fn func(HistoricTrade) error) error {
+	return stream(ctx, c.publicClient, c.endpoint("StreamAllTrades", "GET", "/v2/history/trades"), fn)
 }
 
 // GET /v2/orders/:marketId
-func (c *authClient) GetActiveOrdersInMarket(ctx context.Context, marketId MarketID) (*ActiveOrders, error) {
-	uri, err := c.baseurl.Parse("/v2/orders/" + string(marketId))
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := ActiveOrders{}
-		err = json.Unmarshal(body, &m)
-		return &m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+func (c *authClient) GetActiveOrdersInMarket(ctx context.Context, marketId MarketID) (ActiveOrders, error) {
+	return call[ActiveOrders](ctx, c.publicClient, c.endpoint("GetActiveOrdersInMarket", "GET", "/v2/orders/"+string(marketId)))
 }
 
 // DELETE /v2/orders
-func (c *authClient) DeleteAllOrders(ctx context.Context) (*ActiveOrders, error) {
-	uri, err := c.baseurl.Parse("/v2/orders")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "DELETE", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+func (c *authClient) DeleteAllOrders(ctx context.Context) (ActiveOrders, error) {
+	return call[ActiveOrders](ctx, c.publicClient, c.endpoint("DeleteAllOrders", "DELETE", "/v2/orders"))
+}
+
+// DELETE /v2/orders/:orderId/:marketId/detailed
+//
+// CancelOrder cancels a single order and returns its final state, with the
+// amount matched before the cancel.
+func (c *authClient) CancelOrder(ctx context.Context, orderId int64, marketId MarketID) (*ActiveOrder, error) {
+	path := "/v2/orders/" + strconv.FormatInt(orderId, 10) + "/" + string(marketId) + "/detailed"
+	m, err := call[ActiveOrder](ctx, c.publicClient, c.endpoint("CancelOrder", "DELETE", path))
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 200 {
-		m := ActiveOrders{}
-		err = json.Unmarshal(body, &m)
-		return &m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return &m, nil
 }
 
 type CreateOrderResponse struct {
@@ -206,39 +112,19 @@ type CreateOrderRequest struct {
 	Type   OrderType `json:"type"`
 	Price  float64   `json:"price,string"`
 	Amount float64   `json:"amount,string"`
+	// ClientOrderID optionally identifies the order locally. Firi has no
+	// client order ids, so it is never sent; see orders.Placer.
+	ClientOrderID string `json:"-"`
 }
 
 // POST /v2/orders
 func (c *authClient) PostOrder(ctx context.Context, r *CreateOrderRequest) (*CreateOrderResponse, error) {
-	uri, err := c.baseurl.Parse("/v2/orders")
+	e := c.endpoint("PostOrder", "POST", "/v2/orders").withBody(r).accepting(200, 201)
+	m, err := call[CreateOrderResponse](ctx, c.publicClient, e)
 	if err != nil {
 		return nil, err
 	}
-	data, err := json.Marshal(r)
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "POST", uri.String(), bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 || resp.StatusCode == 201 {
-		m := CreateOrderResponse{}
-		err = json.Unmarshal(body, &m)
-		return &m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return &m, nil
 }
 
 type CreateWithdrawalRequest struct {
@@ -249,44 +135,24 @@ type CreateWithdrawalResponse struct{}
 
 // POST /v2/withdraw/:coin
 func (c *authClient) PostWithdrawal(ctx context.Context, coinId string, r *CreateWithdrawalRequest) (*CreateWithdrawalResponse, error) {
-	uri, err := c.baseurl.Parse("/v2/withdraw/" + coinId)
-	if err != nil {
-		return nil, err
-	}
-	data, err := json.Marshal(r)
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "POST", uri.String(), bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	e := c.endpoint("PostWithdrawal", "POST", "/v2/withdraw/"+coinId).withBody(r).accepting(200, 201)
+	m, err := call[CreateWithdrawalResponse](ctx, c.publicClient, e)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 200 || resp.StatusCode == 201 {
-		m := CreateWithdrawalResponse{}
-		err = json.Unmarshal(body, &m)
-		return &m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+	return &m, nil
 }
 
-func (c *authClient) doSigned(r *http.Request) (*http.Response, error) {
+func (c *publicClient) doSigned(r *http.Request, s *signer) (*http.Response, error) {
+	if err := c.wait(r.Context()); err != nil {
+		return nil, err
+	}
 	now := time.Now()
-	sig, err := c.signer.Sign(now)
+	sig, err := s.Sign(now)
 	if err != nil {
 		return nil, err
 	}
-	r.Header.Set("miraiex-access-key", c.signer.apiKey)
+	r.Header.Set("miraiex-access-key", s.apiKey)
 	r.Header.Set("miraiex-user-clientid", sig.ClientID)
 	r.Header.Set("miraiex-user-signature", sig.Signature)
 	uri := *r.URL
@@ -296,33 +162,10 @@ func (c *authClient) doSigned(r *http.Request) (*http.Response, error) {
 	uri.RawQuery = q.Encode()
 	r.URL = &uri
 
-	return c.do(r)
+	return c.roundTrip(r, ClientPrivate)
 }
 
 // GET /v2/balances
-func (c *authClient) GetBalancesV2(ctx context.Context) (*Balances, error) {
-	uri, err := c.baseurl.Parse("/v2/balances")
-	if err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", uri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doSigned(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 200 {
-		m := Balances{}
-		err = json.Unmarshal(body, &m)
-		return &m, err
-	} else {
-		return nil, fmt.Errorf("%v: %v: status=%v body=%v", req.Method, uri.String(), resp.StatusCode, string(body))
-	}
+func (c *authClient) GetBalancesV2(ctx context.Context) (Balances, error) {
+	return call[Balances](ctx, c.publicClient, c.endpoint("GetBalancesV2", "GET", "/v2/balances"))
 }
@@ -0,0 +1,88 @@
+package firiclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces requests. Wait blocks until a request may be sent, or
+// returns ctx's error if it is done first.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter makes every request, public and signed, wait for l first.
+// Signed requests wait before they are signed, so waiting cannot expire them.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(c *publicClient) {
+		c.limiter = l
+	}
+}
+
+// NewRateLimiter returns a token bucket allowing perSecond requests on
+// average, and bursts of up to burst requests. perSecond must be positive
+// and burst at least 1.
+func NewRateLimiter(perSecond float64, burst int) (RateLimiter, error) {
+	if !(perSecond > 0) {
+		return nil, fmt.Errorf("firiclient: rate limit must be positive, got %v", perSecond)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("firiclient: rate limit burst must be at least 1, got %v", burst)
+	}
+	return &tokenBucket{
+		rate:    perSecond,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+		nowFunc: time.Now,
+	}, nil
+}
+
+type tokenBucket struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	nowFunc func() time.Time
+}
+
+// reserve takes a token, going into debt if there is none, and returns how
+// long to wait until the debt is paid.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.nowFunc()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wait := b.reserve()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		// give the token back for the next caller
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package firiclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	l, err := NewRateLimiter(10, 2)
+	if err != nil {
+		t.Fatalf("error creating limiter: %v", err)
+	}
+	b := l.(*tokenBucket)
+	b.last = now
+	b.nowFunc = func() time.Time { return now }
+
+	if b.reserve() != 0 || b.reserve() != 0 {
+		t.Fatalf("expected burst of 2 without waiting")
+	}
+	if wait := b.reserve(); wait != 100*time.Millisecond {
+		t.Errorf("expected to wait 100ms for the third token, got %v", wait)
+	}
+	if wait := b.reserve(); wait != 200*time.Millisecond {
+		t.Errorf("expected to wait 200ms for the fourth token, got %v", wait)
+	}
+
+	// a second refills 10 tokens, minus the 2 owed, capped at the burst
+	now = now.Add(time.Second)
+	if b.reserve() != 0 || b.reserve() != 0 || b.reserve() == 0 {
+		t.Errorf("expected the bucket to refill to its burst")
+	}
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	l, _ := NewRateLimiter(1, 1)
+	c := newTestAuthClient(statusDoer(200, `{"time":1}`), WithRateLimiter(l))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetServerTime(ctx); err != nil {
+		t.Fatalf("expected first request to pass, got %v", err)
+	}
+	if _, err := c.GetServerTime(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected second request to wait past the deadline, got %v", err)
+	}
+}
+
+func TestNewRateLimiterRejectsInvalidLimits(t *testing.T) {
+	for _, c := range []struct {
+		perSecond float64
+		burst     int
+	}{{0, 1}, {-1, 1}, {math.NaN(), 1}, {1, 0}} {
+		if _, err := NewRateLimiter(c.perSecond, c.burst); err == nil {
+			t.Errorf("expected an error for perSecond=%v burst=%v", c.perSecond, c.burst)
+		}
+	}
+}
+
+type limiterFunc func(ctx context.Context) error
+
+func (f limiterFunc) Wait(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestSignedRequestWaitsBeforeSigning(t *testing.T) {
+	waits := 0
+	var waited time.Time
+	l := limiterFunc(func(ctx context.Context) error {
+		waits++
+		// wait into the next second, so a signature made before waiting is stale
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		waited = time.Now()
+		return nil
+	})
+	var timestamp string
+	doer := func(r *http.Request) (*http.Response, error) {
+		timestamp = r.URL.Query().Get("timestamp")
+		return statusDoer(200, `[]`)(r)
+	}
+	c := newTestAuthClient(doer, WithRateLimiter(l))
+	if _, err := c.GetBalancesV2(context.Background()); err != nil {
+		t.Fatalf("error getting balances: %v", err)
+	}
+	if waits != 1 {
+		t.Errorf("expected a signed request to wait once, waited %v times", waits)
+	}
+	if want := strconv.FormatInt(waited.Unix(), 10); timestamp != want {
+		t.Errorf("expected the request signed after waiting at %v, got %v", want, timestamp)
+	}
+}
+
+func TestElapsedLeavesOutWaiting(t *testing.T) {
+	l := limiterFunc(func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	logger := &captureLogger{}
+	c := newTestAuthClient(statusDoer(200, `[]`), WithRateLimiter(l), WithLogger(logger))
+	if _, err := c.GetMarketsV2(context.Background()); err != nil {
+		t.Fatalf("error getting markets: %v", err)
+	}
+	res := logger.entries[len(logger.entries)-1]
+	if elapsed := res.fields["elapsed"].(time.Duration); elapsed >= 50*time.Millisecond {
+		t.Errorf("expected elapsed to leave out the limiter wait, got %v", elapsed)
+	}
+}
@@ -0,0 +1,232 @@
+package firiclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const redacted = "REDACTED"
+
+// RedactionPolicy decides what is hidden from logs, errors and debug dumps.
+type RedactionPolicy struct {
+	// QueryParams are query parameters whose values are redacted.
+	QueryParams []string
+	// Headers are header names whose values are redacted, matched case-insensitively.
+	Headers []string
+	// HeaderPrefixes redact every header starting with one of them.
+	HeaderPrefixes []string
+
+	mu sync.RWMutex
+	// secrets are literal values, e.g. the api key, scrubbed from any text.
+	secrets []string
+}
+
+// NewRedactionPolicy returns the default policy: the query parameters added
+// when signing, the miraiex-* credential headers and common auth headers.
+func NewRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		QueryParams:    []string{"timestamp", "validity", "signature"},
+		Headers:        []string{"Authorization", "Cookie", "Set-Cookie"},
+		HeaderPrefixes: []string{"miraiex-"},
+	}
+}
+
+// WithRedaction replaces the default redaction policy. A nil policy keeps the default.
+func WithRedaction(p *RedactionPolicy) Option {
+	return func(c *publicClient) {
+		if p == nil {
+			p = NewRedactionPolicy()
+		}
+		c.redact = p
+	}
+}
+
+// Clone returns a copy of p that can be changed without affecting p.
+func (p *RedactionPolicy) Clone() *RedactionPolicy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return &RedactionPolicy{
+		QueryParams:    append([]string(nil), p.QueryParams...),
+		Headers:        append([]string(nil), p.Headers...),
+		HeaderPrefixes: append([]string(nil), p.HeaderPrefixes...),
+		secrets:        append([]string(nil), p.secrets...),
+	}
+}
+
+// AddSecret scrubs every occurrence of value from redacted text.
+func (p *RedactionPolicy) AddSecret(value string) {
+	if value == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.secrets {
+		if s == value {
+			return
+		}
+	}
+	p.secrets = append(p.secrets, value)
+}
+
+// URL returns u as a string with redacted query parameters.
+func (p *RedactionPolicy) URL(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for _, name := range p.QueryParams {
+		if q.Has(name) {
+			q.Set(name, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return p.String(u.String())
+	}
+	cp := *u
+	cp.RawQuery = q.Encode()
+	return p.String(cp.String())
+}
+
+// Error returns err with the URL of a *url.Error redacted, as transport
+// errors carry the full request URL.
+func (p *RedactionPolicy) Error(err error) error {
+	uerr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	cp := *uerr
+	if u, perr := url.Parse(uerr.URL); perr == nil {
+		cp.URL = p.URL(u)
+	} else {
+		cp.URL = redacted
+	}
+	return &cp
+}
+
+func (p *RedactionPolicy) isSecretHeader(name string) bool {
+	for _, h := range p.Headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	lower := strings.ToLower(name)
+	for _, prefix := range p.HeaderPrefixes {
+		if strings.HasPrefix(lower, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns a copy of h with secret headers redacted.
+func (p *RedactionPolicy) Header(h http.Header) http.Header {
+	res := http.Header{}
+	for k, v := range h {
+		if p.isSecretHeader(k) {
+			res[k] = []string{redacted}
+		} else {
+			res[k] = append([]string(nil), v...)
+		}
+	}
+	return res
+}
+
+// String scrubs known secret values from s.
+func (p *RedactionPolicy) String(s string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, secret := range p.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func flattenHeader(h http.Header) map[string]string {
+	res := map[string]string{}
+	for k, v := range h {
+		res[k] = strings.Join(v, ", ")
+	}
+	return res
+}
+
+// APIError is returned when the API responds with an unexpected status.
+// URL and Body are redacted.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%v: %v: status=%v body=%v", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+func (c *publicClient) apiError(req *http.Request, resp *http.Response, body []byte) error {
+	return &APIError{
+		Method:     req.Method,
+		URL:        c.redact.URL(req.URL),
+		StatusCode: resp.StatusCode,
+		Body:       c.redact.String(string(body)),
+	}
+}
+
+// WithDebugDump writes every raw HTTP request and response to w, redacted.
+// Meant for debugging only, as it buffers bodies and is slow.
+func WithDebugDump(w io.Writer) Option {
+	return func(c *publicClient) {
+		c.dump = w
+	}
+}
+
+func (c *publicClient) dumpRequest(r *http.Request) {
+	if c.dump == nil {
+		return
+	}
+	cp := r.Clone(r.Context())
+	cp.Header = c.redact.Header(r.Header)
+	if r.Body != nil && r.Body != http.NoBody {
+		data, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		cp.Body = io.NopCloser(bytes.NewReader(data))
+		if err != nil {
+			fmt.Fprintf(c.dump, "error reading request body: %v\n", err)
+			return
+		}
+	}
+	cp.URL, _ = url.Parse(c.redact.URL(r.URL))
+	data, err := httputil.DumpRequestOut(cp, true)
+	if err != nil {
+		fmt.Fprintf(c.dump, "error dumping request: %v\n", err)
+		return
+	}
+	c.writeDump(data)
+}
+
+func (c *publicClient) dumpResponse(res *http.Response) {
+	if c.dump == nil || res == nil {
+		return
+	}
+	cp := *res
+	cp.Header = c.redact.Header(res.Header)
+	data, err := httputil.DumpResponse(&cp, true)
+	// DumpResponse replaced the body of the copy with a re-readable one
+	res.Body = cp.Body
+	if err != nil {
+		fmt.Fprintf(c.dump, "error dumping response: %v\n", err)
+		return
+	}
+	c.writeDump(data)
+}
+
+func (c *publicClient) writeDump(data []byte) {
+	c.dumpMu.Lock()
+	defer c.dumpMu.Unlock()
+	io.WriteString(c.dump, c.redact.String(string(data))+"\n")
+}
@@ -0,0 +1,91 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactionOfErrorsAndDumps(t *testing.T) {
+	const apiKey = "my-api-key"
+	doer := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 401,
+			Status:     "401 Unauthorized",
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"error":"invalid key my-api-key"}`))),
+		}, nil
+	}
+	dump := &bytes.Buffer{}
+	base, _ := url.Parse("https://api.firi.com")
+	public := New(base, doer, WithLogger(NopLogger()), WithDebugDump(dump))
+	c := NewAuthenticatedClient(base, NewSigner("client", apiKey, secretKey), public, doer)
+
+	_, err := c.PostOrder(context.Background(), &CreateOrderRequest{Market: "BTCNOK", Type: Bid, Price: 1, Amount: 1})
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != 401 {
+		t.Errorf("unexpected status=%v", apiErr.StatusCode)
+	}
+	if strings.Contains(err.Error(), apiKey) || !strings.Contains(apiErr.URL, "timestamp="+redacted) {
+		t.Errorf("expected redacted error, got %v", err)
+	}
+
+	out := dump.String()
+	if strings.Contains(out, apiKey) {
+		t.Errorf("dump leaks api key:\n%v", out)
+	}
+	if !strings.Contains(out, `"market":"BTCNOK"`) || !strings.Contains(out, "401 Unauthorized") {
+		t.Errorf("expected request and response in dump:\n%v", out)
+	}
+	if !strings.Contains(strings.ToLower(out), "miraiex-user-signature: "+strings.ToLower(redacted)) {
+		t.Errorf("expected signature header to be redacted:\n%v", out)
+	}
+}
+
+func TestNilRedactionKeepsDefault(t *testing.T) {
+	c := newTestAuthClient(statusDoer(200, `[]`), WithRedaction(nil))
+	if c.redact == nil || c.redact.URL(&url.URL{RawQuery: "signature=abc"}) != "?signature=REDACTED" {
+		t.Errorf("expected the default policy for a nil policy")
+	}
+}
+
+func TestTransportErrorsAreRedacted(t *testing.T) {
+	doer := func(r *http.Request) (*http.Response, error) {
+		return nil, &url.Error{Op: r.Method, URL: r.URL.String(), Err: errors.New("connection reset")}
+	}
+	logger := &captureLogger{}
+	c := newTestAuthClient(doer, WithLogger(logger))
+	_, err := c.GetActiveOrders(context.Background())
+	uerr := &url.Error{}
+	if !errors.As(err, &uerr) {
+		t.Fatalf("expected a url.Error, got %v", err)
+	}
+	if !strings.Contains(uerr.URL, "timestamp="+redacted) {
+		t.Errorf("expected a redacted url in the error, got %v", uerr.URL)
+	}
+	for _, e := range logger.entries {
+		if logged := fmt.Sprint(e.msg, e.fields["error"]); !strings.Contains(logged, "validity="+redacted) {
+			t.Errorf("expected a redacted url in the log, got %v", logged)
+		}
+	}
+}
+
+func TestAuthenticatedClientKeepsSharedPolicy(t *testing.T) {
+	const apiKey = "my-api-key"
+	policy := NewRedactionPolicy()
+	base, _ := url.Parse("https://api.firi.com")
+	public := New(base, statusDoer(200, `[]`), WithRedaction(policy))
+	NewAuthenticatedClient(base, NewSigner("client", apiKey, secretKey), public, statusDoer(200, `[]`))
+	if policy.String(apiKey) != apiKey {
+		t.Errorf("expected the shared policy to be left unchanged")
+	}
+}
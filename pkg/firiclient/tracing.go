@@ -0,0 +1,58 @@
+package firiclient
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/esiqveland/firi/pkg/firiclient"
+
+// WithTracerProvider creates a span for every client method and for every
+// HTTP round trip it makes. Without it, no spans are created.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *publicClient) {
+		c.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+func (c *publicClient) startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "firi."+method)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *publicClient) startHTTPSpan(r *http.Request, client ClientType, requestId string) trace.Span {
+	endpoint := EndpointTemplate(r.URL.Path)
+	_, span := c.tracer.Start(r.Context(), "HTTP "+r.Method+" "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethod(r.Method),
+			semconv.HTTPRoute(endpoint),
+			semconv.URLFull(c.redact.URL(r.URL)),
+			attribute.String("firi.client", string(client)),
+			attribute.String("firi.request_id", requestId),
+		),
+	)
+	return span
+}
+
+func endHTTPSpan(span trace.Span, res *http.Response, err error) {
+	if res != nil {
+		span.SetAttributes(semconv.HTTPStatusCode(res.StatusCode))
+		if res.StatusCode >= 400 {
+			span.SetStatus(codes.Error, res.Status)
+		}
+	}
+	endSpan(span, err)
+}
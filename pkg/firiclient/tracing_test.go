@@ -0,0 +1,66 @@
+package firiclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func attr(attrs []attribute.KeyValue, key string) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	doer := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 500,
+			Status:     "500 Internal Server Error",
+			Body:       io.NopCloser(bytes.NewReader([]byte(`{"name":"InternalError"}`))),
+		}, nil
+	}
+	base, _ := url.Parse("https://api.firi.com")
+	public := New(base, doer, WithTracerProvider(tp))
+	c := NewAuthenticatedClient(base, NewSigner("client", "key", secretKey), public, doer)
+
+	_, err := c.PostOrder(context.Background(), &CreateOrderRequest{Market: "BTCNOK", Type: Bid, Price: 1, Amount: 1})
+	if err == nil {
+		t.Fatalf("expected error from PostOrder")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", len(spans))
+	}
+	httpSpan, methodSpan := spans[0], spans[1]
+	if methodSpan.Name != "firi.PostOrder" || methodSpan.Status.Code != codes.Error {
+		t.Errorf("unexpected method span name=%v status=%v", methodSpan.Name, methodSpan.Status)
+	}
+	if httpSpan.Name != "HTTP POST /v2/orders" || httpSpan.Parent.SpanID() != methodSpan.SpanContext.SpanID() {
+		t.Errorf("unexpected http span name=%v parent=%v", httpSpan.Name, httpSpan.Parent.SpanID())
+	}
+	if v, ok := attr(httpSpan.Attributes, "http.status_code"); !ok || v.AsInt64() != 500 {
+		t.Errorf("expected http.status_code=500, got %v", v.Emit())
+	}
+	if v, ok := attr(httpSpan.Attributes, "firi.request_id"); !ok || v.AsString() == "" {
+		t.Errorf("expected firi.request_id attribute")
+	}
+	if v, _ := attr(httpSpan.Attributes, "firi.client"); v.AsString() != string(ClientPrivate) {
+		t.Errorf("expected private client, got %v", v.Emit())
+	}
+}
@@ -0,0 +1,112 @@
+package marketmaker
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/esiqveland/firi/pkg/fees"
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/orders"
+)
+
+// Grid quotes a fixed ladder of price levels between Lower and Upper: bids
+// on the levels below the mid and asks on those above. As the price moves
+// through the grid, filled bids turn into asks one level up and filled asks
+// into bids one level down, capturing the spacing on every round trip. The
+// level of a filled order stays empty until its counter order fills.
+type Grid struct {
+	Lower  float64
+	Upper  float64
+	Levels int
+	// Amount is the base amount quoted on each level.
+	Amount float64
+	// Fees are the rates paid on both legs. A counter order skips levels
+	// closer to the fill than its breakeven price, leaving them empty, so no
+	// round trip loses money to fees.
+	Fees fees.Rates
+
+	// sides holds the levels decided by fills rather than by the mid, with
+	// an empty side for levels left empty.
+	sides map[int]firiclient.OrderType
+}
+
+func NewGrid(lower, upper float64, levels int, amount float64) (*Grid, error) {
+	if lower <= 0 || upper <= lower || levels < 2 || amount <= 0 {
+		return nil, fmt.Errorf("marketmaker: invalid grid lower=%v upper=%v levels=%v amount=%v", lower, upper, levels, amount)
+	}
+	return &Grid{Lower: lower, Upper: upper, Levels: levels, Amount: amount}, nil
+}
+
+// Prices returns the price levels of the grid, lowest first.
+func (g *Grid) Prices() []float64 {
+	step := (g.Upper - g.Lower) / float64(g.Levels-1)
+	prices := make([]float64, g.Levels)
+	for i := range prices {
+		prices[i] = g.Lower + float64(i)*step
+	}
+	return prices
+}
+
+func (g *Grid) Quotes(s *State) []Quote {
+	g.fill(s.Fills)
+	mid := s.Mid()
+	if mid <= 0 {
+		return nil
+	}
+	var quotes []Quote
+	for i, p := range g.Prices() {
+		side, ok := g.sides[i]
+		switch {
+		case ok && side == "":
+		case ok:
+			quotes = append(quotes, Quote{Side: side, Price: p, Amount: g.Amount})
+		case p < mid:
+			quotes = append(quotes, Quote{Side: firiclient.Bid, Price: p, Amount: g.Amount})
+		case p > mid:
+			quotes = append(quotes, Quote{Side: firiclient.Ask, Price: p, Amount: g.Amount})
+		}
+	}
+	return quotes
+}
+
+// fill empties the levels of fully filled orders, and moves their counter
+// orders to the next level: up for bids, down for asks.
+func (g *Grid) fill(fills []orders.Event) {
+	if g.sides == nil {
+		g.sides = map[int]firiclient.OrderType{}
+	}
+	step := (g.Upper - g.Lower) / float64(g.Levels-1)
+	for _, ev := range fills {
+		if ev.Type != orders.EventFilled {
+			continue
+		}
+		level := math.Round((ev.Order.Price - g.Lower) / step)
+		if level < 0 || level >= float64(g.Levels) || math.Abs(g.Lower+level*step-ev.Order.Price) > step/100 {
+			continue
+		}
+		i := int(level)
+		g.sides[i] = ""
+		switch ev.Order.Type {
+		case firiclient.Bid:
+			min := fees.BreakevenAsk(ev.Order.Price, g.Fees.Maker, g.Fees.Maker)
+			j := i + 1
+			for j < g.Levels && g.Lower+float64(j)*step < min {
+				g.sides[j] = ""
+				j++
+			}
+			if j < g.Levels {
+				g.sides[j] = firiclient.Ask
+			}
+		case firiclient.Ask:
+			max := fees.BreakevenBid(ev.Order.Price, g.Fees.Maker, g.Fees.Maker)
+			j := i - 1
+			for j >= 0 && g.Lower+float64(j)*step > max {
+				g.sides[j] = ""
+				j--
+			}
+			if j >= 0 {
+				g.sides[j] = firiclient.Bid
+			}
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Package marketmaker runs market-making strategies: a strategy says which
+// quotes it wants in the book, and the engine places and cancels orders to
+// match, within inventory limits.
+package marketmaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/orders"
+)
+
+// Quote is an order a strategy wants resting in the book.
+type Quote struct {
+	Side   firiclient.OrderType
+	Price  float64
+	Amount float64
+}
+
+// State is what a strategy sees each cycle. Fills holds the fill events of
+// own orders in the market since the previous cycle, and Open the orders the
+// engine placed that are still open.
+type State struct {
+	Time      time.Time
+	Market    firiclient.MarketID
+	Book      *firiclient.Orderbook
+	Ticker    *firiclient.MarketTicker
+	Fills     []orders.Event
+	Open      firiclient.ActiveOrders
+	Inventory float64
+	Cash      float64
+}
+
+// Mid is the middle of the best bid and ask, from the book or else the ticker.
+func (s *State) Mid() float64 {
+	if s.Book != nil && len(s.Book.Bids) > 0 && len(s.Book.Asks) > 0 {
+		return (s.Book.Bids[0].Price + s.Book.Asks[0].Price) / 2
+	}
+	if s.Ticker != nil && s.Ticker.Bid > 0 && s.Ticker.Ask > 0 {
+		return (s.Ticker.Bid + s.Ticker.Ask) / 2
+	}
+	return 0
+}
+
+type Strategy interface {
+	// Quotes returns every quote the strategy wants in the book. Returning
+	// no quotes cancels all orders the engine placed in the market.
+	Quotes(s *State) []Quote
+}
+
+type StrategyFunc func(s *State) []Quote
+
+func (f StrategyFunc) Quotes(s *State) []Quote {
+	return f(s)
+}
+
+type Config struct {
+	Market   firiclient.MarketID
+	Interval time.Duration
+	// MaxInventory caps the base currency held plus what resting bids could
+	// buy. Zero means no cap.
+	MaxInventory float64
+	// MinInventory is the base currency kept after what resting asks could sell.
+	MinInventory float64
+	// PriceTolerance is how far, as a fraction of the price, an open order may
+	// be from a quote and still stand for it. Defaults to 0.0005.
+	PriceTolerance float64
+	// Batch bounds the concurrency and rate of the orders placed and cancelled.
+	Batch orders.BatchConfig
+}
+
+// Cycle is the outcome of one engine cycle.
+type Cycle struct {
+	Quotes    []Quote
+	Kept      int
+	Placed    int
+	Cancelled int
+}
+
+type Engine struct {
+	api      firiclient.PrivateAPI
+	strategy Strategy
+	cfg      Config
+	tracker  *orders.Tracker
+	batcher  *orders.Batcher
+	base     string
+	quote    string
+	// own holds the ids of the orders the engine placed and has not seen
+	// close. Other orders in the market are left alone.
+	own     map[int64]bool
+	nowFunc func() time.Time
+}
+
+func NewEngine(api firiclient.PrivateAPI, strategy Strategy, cfg Config) (*Engine, error) {
+	m := string(cfg.Market)
+	if !strings.HasSuffix(m, "NOK") || len(m) <= 3 {
+		return nil, fmt.Errorf("marketmaker: unsupported market %q", cfg.Market)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.PriceTolerance <= 0 {
+		cfg.PriceTolerance = 0.0005
+	}
+	cfg.Batch.Rollback = false
+	return &Engine{
+		api:      api,
+		strategy: strategy,
+		cfg:      cfg,
+		tracker:  orders.NewTracker(api, orders.TrackerConfig{}),
+		batcher:  orders.NewBatcher(api, cfg.Batch),
+		base:     strings.TrimSuffix(m, "NOK"),
+		quote:    "NOK",
+		own:      map[int64]bool{},
+		nowFunc:  time.Now,
+	}, nil
+}
+
+// Run cycles until ctx is done, then cancels the orders it placed.
+// Failed cycles are logged and retried on the next tick.
+func (e *Engine) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	t := time.NewTicker(e.cfg.Interval)
+	defer t.Stop()
+	for {
+		if _, err := e.Cycle(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msgf("marketmaker: cycle failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			cctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			return errors.Join(ctx.Err(), e.cancelAll(cctx))
+		case <-t.C:
+		}
+	}
+}
+
+// Cycle gathers the market state, asks the strategy for quotes, limits them
+// to the inventory bounds, and reconciles them with the open orders.
+func (e *Engine) Cycle(ctx context.Context) (*Cycle, error) {
+	s, err := e.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quotes := e.limit(s, e.strategy.Quotes(s))
+	keep, cancel, place := e.diff(s.Open, quotes)
+	res := &Cycle{Quotes: quotes, Kept: len(keep)}
+
+	// cancel first to free the balance held by replaced orders
+	refs := make([]orders.OrderRef, 0, len(cancel))
+	for _, o := range cancel {
+		refs = append(refs, orders.OrderRef{Id: o.Id, Market: e.cfg.Market})
+	}
+	cancelled, cerr := e.batcher.CancelOrders(ctx, refs)
+	for _, c := range cancelled {
+		if c.Err == nil {
+			res.Cancelled++
+		}
+	}
+	reqs := make([]firiclient.CreateOrderRequest, 0, len(place))
+	for _, q := range place {
+		reqs = append(reqs, firiclient.CreateOrderRequest{Market: string(e.cfg.Market), Type: q.Side, Price: q.Price, Amount: q.Amount})
+	}
+	placed, perr := e.batcher.PostOrders(ctx, reqs)
+	for _, p := range placed {
+		if p.Err == nil {
+			e.own[p.Order.Id] = true
+			res.Placed++
+		}
+	}
+	return res, errors.Join(cerr, perr)
+}
+
+func (e *Engine) state(ctx context.Context) (*State, error) {
+	events, err := e.tracker.Poll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	book, err := e.api.GetOrderbookV2(ctx, e.cfg.Market)
+	if err != nil {
+		return nil, err
+	}
+	ticker, err := e.api.GetMarketTickerV2(ctx, e.cfg.Market)
+	if err != nil {
+		return nil, err
+	}
+	open, err := e.ownOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := e.api.GetBalancesV2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{Time: e.nowFunc(), Market: e.cfg.Market, Book: book, Ticker: ticker, Open: open}
+	for _, ev := range events {
+		if !e.own[ev.Order.Id] {
+			continue
+		}
+		if ev.Filled > 0 {
+			s.Fills = append(s.Fills, ev)
+		}
+		if ev.Type == orders.EventFilled || ev.Type == orders.EventCancelled {
+			delete(e.own, ev.Order.Id)
+		}
+	}
+	for _, b := range balances {
+		switch b.Currency {
+		case e.base:
+			s.Inventory = b.Balance
+		case e.quote:
+			s.Cash = b.Balance
+		}
+	}
+	return s, nil
+}
+
+// ownOrders returns the open orders in the market that the engine placed.
+func (e *Engine) ownOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	open, err := e.api.GetActiveOrdersInMarket(ctx, e.cfg.Market)
+	if err != nil {
+		return nil, err
+	}
+	var res firiclient.ActiveOrders
+	for _, o := range open {
+		if e.own[o.Id] {
+			res = append(res, o)
+		}
+	}
+	return res, nil
+}
+
+// limit drops or shrinks the quotes furthest from the mid that would take
+// the inventory past its bounds if they all filled. A quote with an order
+// standing for it counts only what is left of that order.
+func (e *Engine) limit(s *State, quotes []Quote) []Quote {
+	var bids, asks []Quote
+	for _, q := range quotes {
+		if q.Price <= 0 || q.Amount <= 0 {
+			continue
+		}
+		switch q.Side {
+		case firiclient.Bid:
+			bids = append(bids, q)
+		case firiclient.Ask:
+			asks = append(asks, q)
+		}
+	}
+	sort.Slice(bids, func(i, j int) bool { return bids[i].Price > bids[j].Price })
+	sort.Slice(asks, func(i, j int) bool { return asks[i].Price < asks[j].Price })
+	for _, side := range [][]Quote{bids, asks} {
+		for i, m := range e.standing(s.Open, side) {
+			if m >= 0 {
+				side[i].Amount = math.Min(side[i].Amount, s.Open[m].Remaining)
+			}
+		}
+	}
+
+	room := math.Inf(1)
+	if e.cfg.MaxInventory > 0 {
+		room = e.cfg.MaxInventory - s.Inventory
+	}
+	res := make([]Quote, 0, len(quotes))
+	res = append(res, fit(bids, room)...)
+	res = append(res, fit(asks, s.Inventory-e.cfg.MinInventory)...)
+	return res
+}
+
+func fit(quotes []Quote, room float64) []Quote {
+	var res []Quote
+	for _, q := range quotes {
+		if room <= 0 {
+			break
+		}
+		q.Amount = math.Min(q.Amount, room)
+		room -= q.Amount
+		res = append(res, q)
+	}
+	return res
+}
+
+// standing returns for each quote the index of the open order on the same
+// side and price level, or -1 if there is none.
+func (e *Engine) standing(open firiclient.ActiveOrders, quotes []Quote) []int {
+	used := make([]bool, len(open))
+	res := make([]int, len(quotes))
+	for i, q := range quotes {
+		res[i] = -1
+		for j, o := range open {
+			if used[j] || o.Type != q.Side {
+				continue
+			}
+			if math.Abs(o.Price-q.Price) <= q.Price*e.cfg.PriceTolerance {
+				used[j] = true
+				res[i] = j
+				break
+			}
+		}
+	}
+	return res
+}
+
+// diff matches open orders to quotes on side and price level. An order
+// keeps standing for its quote as long as what remains of it is no more than
+// the quote, as replacing it would lose its place in the queue. An order
+// left larger than its quote is replaced.
+func (e *Engine) diff(open firiclient.ActiveOrders, quotes []Quote) (keep, cancel firiclient.ActiveOrders, place []Quote) {
+	used := make([]bool, len(open))
+	for i, m := range e.standing(open, quotes) {
+		q := quotes[i]
+		if m < 0 || open[m].Remaining > q.Amount*(1+1e-9) {
+			place = append(place, q)
+			continue
+		}
+		used[m] = true
+		keep = append(keep, open[m])
+	}
+	for i, o := range open {
+		if !used[i] {
+			cancel = append(cancel, o)
+		}
+	}
+	return keep, cancel, place
+}
+
+func (e *Engine) cancelAll(ctx context.Context) error {
+	open, err := e.ownOrders(ctx)
+	if err != nil {
+		return err
+	}
+	refs := make([]orders.OrderRef, 0, len(open))
+	for _, o := range open {
+		refs = append(refs, orders.OrderRef{Id: o.Id, Market: e.cfg.Market})
+	}
+	_, err = e.batcher.CancelOrders(ctx, refs)
+	return err
+}
@@ -0,0 +1,209 @@
+package marketmaker
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/backtest"
+	"github.com/esiqveland/firi/pkg/fees"
+	"github.com/esiqveland/firi/pkg/firiclient"
+	"github.com/esiqveland/firi/pkg/orders"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func setBook(ex *backtest.Exchange, bid, ask float64) {
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Orderbook: &firiclient.Orderbook{
+		Bids: []firiclient.Order{{Price: bid, Quantity: 10}},
+		Asks: []firiclient.Order{{Price: ask, Quantity: 10}},
+	}})
+}
+
+func openQuotes(t *testing.T, ex *backtest.Exchange) []Quote {
+	t.Helper()
+	open, err := ex.GetActiveOrdersInMarket(context.Background(), firiclient.BTCNOK)
+	if err != nil {
+		t.Fatalf("error getting open orders: %v", err)
+	}
+	var res []Quote
+	for _, o := range open {
+		res = append(res, Quote{Side: o.Type, Price: o.Price, Amount: o.Amount})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Price < res[j].Price })
+	return res
+}
+
+func checkQuotes(t *testing.T, got []Quote, bids, asks []float64) {
+	t.Helper()
+	var want []Quote
+	for _, p := range bids {
+		want = append(want, Quote{Side: firiclient.Bid, Price: p, Amount: 0.5})
+	}
+	for _, p := range asks {
+		want = append(want, Quote{Side: firiclient.Ask, Price: p, Amount: 0.5})
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected quotes %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected quotes %v, got %v", want, got)
+			return
+		}
+	}
+}
+
+func TestGridEngine(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 2})
+	setBook(ex, 99, 101)
+
+	grid, err := NewGrid(95, 105, 11, 0.5)
+	if err != nil {
+		t.Fatalf("error creating grid: %v", err)
+	}
+	var fills int
+	strategy := StrategyFunc(func(s *State) []Quote {
+		fills += len(s.Fills)
+		return grid.Quotes(s)
+	})
+	e, err := NewEngine(ex, strategy, Config{Market: firiclient.BTCNOK, MaxInventory: 3, MinInventory: 0.5})
+	if err != nil {
+		t.Fatalf("error creating engine: %v", err)
+	}
+
+	// inventory of 2 leaves room to buy 1 and sell 1.5
+	cycle, err := e.Cycle(ctx)
+	if err != nil {
+		t.Fatalf("error running cycle: %v", err)
+	}
+	if cycle.Placed != 5 {
+		t.Errorf("expected 5 orders placed, got %+v", cycle)
+	}
+	checkQuotes(t, openQuotes(t, ex), []float64{98, 99}, []float64{101, 102, 103})
+
+	cycle, _ = e.Cycle(ctx)
+	if cycle.Kept != 5 || cycle.Placed != 0 || cycle.Cancelled != 0 {
+		t.Errorf("expected unchanged quotes to be kept, got %+v", cycle)
+	}
+
+	// the bid at 99 fills and the price falls
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+		{OrderType: firiclient.Ask, Price: 99, Amount: 0.5, CreatedAt: t0},
+	}})
+	setBook(ex, 97, 99)
+	cycle, err = e.Cycle(ctx)
+	if err != nil {
+		t.Fatalf("error running cycle: %v", err)
+	}
+	if fills != 1 {
+		t.Errorf("expected the strategy to see 1 fill, got %v", fills)
+	}
+	// the filled level stays empty and its ask goes one level up
+	checkQuotes(t, openQuotes(t, ex), []float64{97}, []float64{100, 101, 102, 103})
+	if cycle.Kept != 3 || cycle.Cancelled != 1 || cycle.Placed != 2 {
+		t.Errorf("expected 3 kept, 1 cancelled and 2 placed, got %+v", cycle)
+	}
+
+	// the ask at 100 fills, and the bid goes back to 99
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+		{OrderType: firiclient.Bid, Price: 100, Amount: 0.5, CreatedAt: t0},
+	}})
+	setBook(ex, 98, 100.5)
+	if _, err := e.Cycle(ctx); err != nil {
+		t.Fatalf("error running cycle: %v", err)
+	}
+	checkQuotes(t, openQuotes(t, ex), []float64{98, 99}, []float64{101, 102, 103})
+}
+
+func TestEngineCancelsOnShutdown(t *testing.T) {
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 2})
+	setBook(ex, 99, 101)
+	grid, _ := NewGrid(95, 105, 11, 0.5)
+	e, _ := NewEngine(ex, grid, Config{Market: firiclient.BTCNOK, Interval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+	for len(openQuotes(t, ex)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if open := openQuotes(t, ex); len(open) != 0 {
+		t.Errorf("expected no orders after shutdown, got %v", open)
+	}
+}
+
+func TestGridCounterOrdersClearFees(t *testing.T) {
+	grid, _ := NewGrid(95, 105, 11, 0.5)
+	grid.Fees = fees.Rates{Maker: 0.008}
+	s := &State{
+		Ticker: &firiclient.MarketTicker{Bid: 97, Ask: 99},
+		Fills:  []orders.Event{{Type: orders.EventFilled, Order: firiclient.ActiveOrder{Type: firiclient.Bid, Price: 99}}},
+	}
+	// buying at 99 breaks even at 100.6, so the ask skips the level at 100
+	var asks []float64
+	for _, q := range grid.Quotes(s) {
+		if q.Side == firiclient.Ask {
+			asks = append(asks, q.Price)
+		}
+	}
+	if len(asks) != 5 || asks[0] != 101 {
+		t.Errorf("expected asks from 101 up, got %v", asks)
+	}
+}
+
+func TestEngineLeavesOtherOrdersAlone(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 2})
+	setBook(ex, 99, 101)
+	manual, err := ex.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 90, Amount: 0.1})
+	if err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	grid, _ := NewGrid(95, 105, 11, 0.5)
+	e, _ := NewEngine(ex, grid, Config{Market: firiclient.BTCNOK, Interval: time.Millisecond})
+
+	cycle, err := e.Cycle(ctx)
+	if err != nil {
+		t.Fatalf("error running cycle: %v", err)
+	}
+	if cycle.Cancelled != 0 {
+		t.Errorf("expected no orders cancelled, got %+v", cycle)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	e.Run(runCtx)
+	open, _ := ex.GetActiveOrdersInMarket(ctx, firiclient.BTCNOK)
+	if len(open) != 1 || open[0].Id != manual.Id {
+		t.Errorf("expected only the manual order after shutdown, got %+v", open)
+	}
+}
+
+func TestEngineKeepsPartiallyFilledOrders(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 2})
+	setBook(ex, 99, 101)
+	grid, _ := NewGrid(95, 105, 11, 0.5)
+	e, _ := NewEngine(ex, grid, Config{Market: firiclient.BTCNOK, MaxInventory: 3, MinInventory: 0.5})
+	if _, err := e.Cycle(ctx); err != nil {
+		t.Fatalf("error running cycle: %v", err)
+	}
+
+	// the bid at 99 is partly filled, leaving room to buy 0.8: what is left
+	// of it and all of the bid at 98. The new inventory adds an ask at 104.
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+		{OrderType: firiclient.Ask, Price: 99, Amount: 0.2, CreatedAt: t0},
+	}})
+	cycle, err := e.Cycle(ctx)
+	if err != nil {
+		t.Fatalf("error running cycle: %v", err)
+	}
+	if cycle.Kept != 5 || cycle.Cancelled != 0 || cycle.Placed != 1 {
+		t.Errorf("expected all orders to be kept and 1 placed, got %+v", cycle)
+	}
+}
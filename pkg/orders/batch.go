@@ -0,0 +1,163 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+// rollbackTimeout bounds a rollback, which runs even when the batch context is done.
+const rollbackTimeout = 30 * time.Second
+
+// ErrSkipped is the result of batch items not attempted after another item failed.
+var ErrSkipped = errors.New("orders: skipped after an earlier failure")
+
+// BatchAPI is the part of the private API batches use.
+type BatchAPI interface {
+	PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error)
+	CancelOrder(ctx context.Context, orderId int64, marketId firiclient.MarketID) (*firiclient.ActiveOrder, error)
+}
+
+type BatchConfig struct {
+	// Concurrency bounds the requests in flight. Defaults to 4.
+	Concurrency int
+	// Limiter paces the requests of a batch. Clients created with
+	// firiclient.WithRateLimiter already wait on their own limiter.
+	Limiter firiclient.RateLimiter
+	// Rollback stops placing orders after the first failed placement, and
+	// cancels the orders the batch did place.
+	Rollback bool
+}
+
+type Batcher struct {
+	api BatchAPI
+	cfg BatchConfig
+}
+
+func NewBatcher(api BatchAPI, cfg BatchConfig) *Batcher {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	return &Batcher{api: api, cfg: cfg}
+}
+
+type PlaceResult struct {
+	Request firiclient.CreateOrderRequest
+	Order   *firiclient.CreateOrderResponse
+	Err     error
+	// Cancelled is the final state of the order if it was rolled back.
+	Cancelled   *firiclient.ActiveOrder
+	RollbackErr error
+}
+
+// OrderRef identifies an order to cancel.
+type OrderRef struct {
+	Id     int64
+	Market firiclient.MarketID
+}
+
+type CancelResult struct {
+	Ref   OrderRef
+	Order *firiclient.ActiveOrder
+	Err   error
+}
+
+// PostOrders places orders concurrently, returning a result for each request
+// in order, and all failures joined as the error.
+func (b *Batcher) PostOrders(ctx context.Context, reqs []firiclient.CreateOrderRequest) ([]PlaceResult, error) {
+	results := make([]PlaceResult, len(reqs))
+	for i := range reqs {
+		results[i].Request = reqs[i]
+	}
+	errs := b.run(ctx, len(reqs), b.cfg.Rollback, func(ctx context.Context, i int) error {
+		res, err := b.api.PostOrder(ctx, &results[i].Request)
+		results[i].Order = res
+		return err
+	})
+
+	failed := false
+	for i, err := range errs {
+		results[i].Err = err
+		failed = failed || err != nil
+	}
+	if failed && b.cfg.Rollback {
+		var refs []OrderRef
+		var placed []int
+		for i, r := range results {
+			if r.Err == nil {
+				refs = append(refs, OrderRef{Id: r.Order.Id, Market: firiclient.MarketID(r.Request.Market)})
+				placed = append(placed, i)
+			}
+		}
+		// the batch ctx may be why placing failed, and must not stop the rollback
+		rctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+		cancelled, _ := b.CancelOrders(rctx, refs)
+		cancel()
+		for j, c := range cancelled {
+			results[placed[j]].Cancelled = c.Order
+			results[placed[j]].RollbackErr = c.Err
+		}
+	}
+
+	var all []error
+	for _, r := range results {
+		all = append(all, r.Err, r.RollbackErr)
+	}
+	return results, errors.Join(all...)
+}
+
+// CancelOrders cancels orders concurrently, returning a result for each
+// order in order, and all failures joined as the error.
+func (b *Batcher) CancelOrders(ctx context.Context, refs []OrderRef) ([]CancelResult, error) {
+	results := make([]CancelResult, len(refs))
+	errs := b.run(ctx, len(refs), false, func(ctx context.Context, i int) error {
+		o, err := b.api.CancelOrder(ctx, refs[i].Id, refs[i].Market)
+		results[i].Order = o
+		return err
+	})
+	for i, err := range errs {
+		results[i].Ref = refs[i]
+		results[i].Err = err
+	}
+	return results, errors.Join(errs...)
+}
+
+// run calls fn for every index with at most Concurrency calls in flight.
+// With abort set, indexes not yet started after a failure are skipped.
+// Calls in flight are never cancelled, as that would leave their outcome unknown.
+func (b *Batcher) run(ctx context.Context, n int, abort bool, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, b.cfg.Concurrency)
+	var wg sync.WaitGroup
+	var aborted atomic.Bool
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		if aborted.Load() {
+			errs[i] = ErrSkipped
+			<-sem
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := ctx.Err()
+			if err == nil && b.cfg.Limiter != nil {
+				err = b.cfg.Limiter.Wait(ctx)
+			}
+			if err == nil {
+				err = fn(ctx, i)
+			}
+			errs[i] = err
+			if err != nil && abort {
+				aborted.Store(true)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
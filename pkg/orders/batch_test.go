@@ -0,0 +1,142 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var errRejected = errors.New("rejected")
+
+// batchAPI rejects orders priced at reject, and records the peak number of
+// concurrent calls.
+type batchAPI struct {
+	reject float64
+	// onReject is called when an order is rejected.
+	onReject func()
+
+	mu        sync.Mutex
+	nextId    int64
+	inFlight  int
+	peak      int
+	cancelled []int64
+}
+
+func (f *batchAPI) enter() {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.peak {
+		f.peak = f.inFlight
+	}
+	f.mu.Unlock()
+	time.Sleep(time.Millisecond)
+}
+
+func (f *batchAPI) leave() {
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+}
+
+func (f *batchAPI) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	f.enter()
+	defer f.leave()
+	if r.Price == f.reject {
+		if f.onReject != nil {
+			f.onReject()
+		}
+		return nil, errRejected
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextId++
+	return &firiclient.CreateOrderResponse{Id: f.nextId}, nil
+}
+
+func (f *batchAPI) CancelOrder(ctx context.Context, orderId int64, marketId firiclient.MarketID) (*firiclient.ActiveOrder, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.enter()
+	defer f.leave()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled = append(f.cancelled, orderId)
+	return &firiclient.ActiveOrder{Id: orderId, Market: string(marketId), Cancelled: 1}, nil
+}
+
+func ladder(n int) []firiclient.CreateOrderRequest {
+	var reqs []firiclient.CreateOrderRequest
+	for i := 0; i < n; i++ {
+		reqs = append(reqs, firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: float64(100 - i), Amount: 1})
+	}
+	return reqs
+}
+
+func TestPostOrdersBoundedConcurrency(t *testing.T) {
+	api := &batchAPI{reject: -1}
+	b := NewBatcher(api, BatchConfig{Concurrency: 3})
+	results, err := b.PostOrders(context.Background(), ladder(20))
+	if err != nil {
+		t.Fatalf("error placing ladder: %v", err)
+	}
+	if len(results) != 20 || results[5].Request.Price != 95 || results[5].Order == nil {
+		t.Errorf("expected results in request order, got %+v", results[5])
+	}
+	if api.peak > 3 {
+		t.Errorf("expected at most 3 concurrent calls, got %v", api.peak)
+	}
+
+	refs := []OrderRef{{Id: 1, Market: "BTCNOK"}, {Id: 2, Market: "BTCNOK"}}
+	cancelled, err := b.CancelOrders(context.Background(), refs)
+	if err != nil || len(cancelled) != 2 || cancelled[1].Order.Id != 2 {
+		t.Errorf("expected 2 cancelled orders, got %+v err=%v", cancelled, err)
+	}
+}
+
+func TestPostOrdersPerItemErrors(t *testing.T) {
+	api := &batchAPI{reject: 98}
+	results, err := NewBatcher(api, BatchConfig{}).PostOrders(context.Background(), ladder(5))
+	if !errors.Is(err, errRejected) {
+		t.Errorf("expected joined rejection, got %v", err)
+	}
+	for i, r := range results {
+		if (r.Err != nil) != (i == 2) {
+			t.Errorf("expected only item 2 to fail, item %v got %v", i, r.Err)
+		}
+	}
+	if len(api.cancelled) != 0 {
+		t.Errorf("expected no cancels without rollback, got %v", api.cancelled)
+	}
+}
+
+func TestPostOrdersRollback(t *testing.T) {
+	api := &batchAPI{reject: 98}
+	results, err := NewBatcher(api, BatchConfig{Concurrency: 1, Rollback: true}).PostOrders(context.Background(), ladder(5))
+	if !errors.Is(err, errRejected) {
+		t.Errorf("expected joined rejection, got %v", err)
+	}
+	if results[0].Cancelled == nil || results[1].Cancelled == nil {
+		t.Errorf("expected placed orders to be rolled back, got %+v", results[:2])
+	}
+	if !errors.Is(results[3].Err, ErrSkipped) || !errors.Is(results[4].Err, ErrSkipped) {
+		t.Errorf("expected orders after the failure to be skipped, got %v %v", results[3].Err, results[4].Err)
+	}
+	if len(api.cancelled) != 2 {
+		t.Errorf("expected 2 cancels, got %v", api.cancelled)
+	}
+}
+
+func TestPostOrdersRollbackAfterContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api := &batchAPI{reject: 98, onReject: cancel}
+	results, _ := NewBatcher(api, BatchConfig{Concurrency: 1, Rollback: true}).PostOrders(ctx, ladder(5))
+	if len(api.cancelled) != 2 || results[0].RollbackErr != nil || results[1].RollbackErr != nil {
+		t.Errorf("expected placed orders to be rolled back after ctx is done, got cancelled=%v results=%+v", api.cancelled, results[:2])
+	}
+}
@@ -0,0 +1,250 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var (
+	// ErrOrderInFlight is returned when an order with the same client order id is being placed.
+	ErrOrderInFlight = errors.New("orders: order with client order id is already being placed")
+	// ErrUnknownOutcome is returned when it could not be determined whether an order was placed.
+	ErrUnknownOutcome = errors.New("orders: unknown order outcome")
+)
+
+// OrderAPI is the part of the private API the placer uses.
+type OrderAPI interface {
+	PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error)
+	GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error)
+	GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error)
+}
+
+type PlacerConfig struct {
+	// Attempts is how many times an order is posted when earlier attempts
+	// are known not to have created it. Defaults to 3.
+	Attempts int
+	// ClockSkew widens the window in which an order created by an ambiguous
+	// attempt is looked for. Defaults to 2s.
+	ClockSkew time.Duration
+	// SettlePolls is how many times orders are looked for after an ambiguous
+	// attempt before posting again, as an order still in flight is not yet
+	// listed. Defaults to 3.
+	SettlePolls int
+	// SettleInterval is the time between those polls. Defaults to 1s.
+	SettleInterval time.Duration
+	// PriceTick and AmountTick are the steps Firi rounds prices and amounts
+	// to. Orders within half a step of a request match it. When zero, they
+	// must be within a millionth of it.
+	PriceTick  float64
+	AmountTick float64
+}
+
+// Placer posts orders without placing them twice. Orders with a client order
+// id are mapped to their Firi order id, and placing the same client order id
+// again returns the existing order.
+//
+// When PostOrder fails without a clear answer, such as on a timeout or a 5xx
+// response, the placer looks for a matching order created since the attempt
+// among active and closed orders in the market, polling over a settle window,
+// before posting again.
+type Placer struct {
+	api     OrderAPI
+	cfg     PlacerConfig
+	nowFunc func() time.Time
+
+	mu       sync.Mutex
+	ids      map[string]int64
+	known    map[int64]bool
+	inFlight map[string]bool
+}
+
+func NewPlacer(api OrderAPI, cfg PlacerConfig) *Placer {
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = 3
+	}
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = 2 * time.Second
+	}
+	if cfg.SettlePolls <= 0 {
+		cfg.SettlePolls = 3
+	}
+	if cfg.SettleInterval <= 0 {
+		cfg.SettleInterval = time.Second
+	}
+	return &Placer{
+		api:      api,
+		cfg:      cfg,
+		nowFunc:  time.Now,
+		ids:      map[string]int64{},
+		known:    map[int64]bool{},
+		inFlight: map[string]bool{},
+	}
+}
+
+// Lookup returns the Firi order id placed for a client order id.
+func (p *Placer) Lookup(clientOrderID string) (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.ids[clientOrderID]
+	return id, ok
+}
+
+// Forget drops the mapping of a client order id, letting it be reused.
+func (p *Placer) Forget(clientOrderID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id, ok := p.ids[clientOrderID]; ok {
+		delete(p.known, id)
+		delete(p.ids, clientOrderID)
+	}
+}
+
+// PlaceOrder posts r, retrying and reconciling ambiguous failures. Errors
+// that show the order was rejected are returned as is. If the outcome stays
+// unknown after all attempts, the error wraps ErrUnknownOutcome.
+func (p *Placer) PlaceOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	if r.ClientOrderID != "" {
+		p.mu.Lock()
+		if id, ok := p.ids[r.ClientOrderID]; ok {
+			p.mu.Unlock()
+			return &firiclient.CreateOrderResponse{Id: id}, nil
+		}
+		if p.inFlight[r.ClientOrderID] {
+			p.mu.Unlock()
+			return nil, ErrOrderInFlight
+		}
+		p.inFlight[r.ClientOrderID] = true
+		p.mu.Unlock()
+		defer func() {
+			p.mu.Lock()
+			delete(p.inFlight, r.ClientOrderID)
+			p.mu.Unlock()
+		}()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < p.cfg.Attempts; attempt++ {
+		sent := p.nowFunc()
+		res, err := p.api.PostOrder(ctx, r)
+		if err == nil {
+			p.remember(r.ClientOrderID, res.Id)
+			return res, nil
+		}
+		if !ambiguous(err) {
+			return nil, err
+		}
+		lastErr = err
+
+		found, err := p.settle(ctx, r, sent)
+		if err != nil {
+			return nil, fmt.Errorf("%w: posting failed with %v, reconciling failed with %v", ErrUnknownOutcome, lastErr, err)
+		}
+		if found != nil {
+			p.remember(r.ClientOrderID, found.Id)
+			return &firiclient.CreateOrderResponse{Id: found.Id}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: giving up after %v attempts: %v", ErrUnknownOutcome, p.cfg.Attempts, lastErr)
+}
+
+// settle polls Reconcile until it finds the order or SettlePolls polls, spaced
+// by SettleInterval, have found nothing.
+func (p *Placer) settle(ctx context.Context, r *firiclient.CreateOrderRequest, since time.Time) (*firiclient.ActiveOrder, error) {
+	for poll := 0; ; poll++ {
+		found, err := p.Reconcile(ctx, r, since)
+		if err != nil || found != nil || poll+1 >= p.cfg.SettlePolls {
+			return found, err
+		}
+		t := time.NewTimer(p.cfg.SettleInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Reconcile looks for an order matching r created since the given time that
+// was not placed through the placer, among active and closed orders in the
+// market. It returns nil if there is none, and an error if there are several.
+func (p *Placer) Reconcile(ctx context.Context, r *firiclient.CreateOrderRequest, since time.Time) (*firiclient.ActiveOrder, error) {
+	active, err := p.api.GetActiveOrdersInMarket(ctx, firiclient.MarketID(r.Market))
+	if err != nil {
+		return nil, err
+	}
+	closed, err := p.api.GetAllFilledAndClosedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from := since.Add(-p.cfg.ClockSkew)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var matches []firiclient.ActiveOrder
+	for _, o := range append(active, closed...) {
+		if o.Market != r.Market || o.Type != r.Type || !near(o.Price, r.Price, p.cfg.PriceTick) || !near(o.Amount, r.Amount, p.cfg.AmountTick) {
+			continue
+		}
+		if o.CreatedAt.Before(from) || p.known[o.Id] {
+			continue
+		}
+		matches = append(matches, o)
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("orders: %v orders match %v %v %v@%v", len(matches), r.Market, r.Type, r.Amount, r.Price)
+	}
+}
+
+func (p *Placer) remember(clientOrderID string, id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.known[id] = true
+	if clientOrderID != "" {
+		p.ids[clientOrderID] = id
+	}
+}
+
+// near reports whether got is want rounded to a step of tick.
+func near(got, want, tick float64) bool {
+	if tick > 0 {
+		return math.Abs(got-want) <= tick/2*(1+1e-9)
+	}
+	return math.Abs(got-want) <= math.Abs(want)*1e-6
+}
+
+// ambiguous reports whether err leaves open whether the order was created:
+// a 5xx response, a transport failure once the request was sent, or a
+// response that could not be read. A 4xx response means it was rejected, and
+// other errors, such as a done context or a failed limiter wait, come before
+// the request is sent.
+func ambiguous(err error) bool {
+	apiErr := &firiclient.APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	urlErr := &url.Error{}
+	syntaxErr := &json.SyntaxError{}
+	typeErr := &json.UnmarshalTypeError{}
+	return errors.As(err, &urlErr) ||
+		errors.As(err, &syntaxErr) ||
+		errors.As(err, &typeErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, firiclient.ErrBodyTooLarge) ||
+		errors.Is(err, firiclient.ErrTrailingData)
+}
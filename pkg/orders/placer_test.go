@@ -0,0 +1,197 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+// timeout is a transport failure after the request was sent.
+var timeout = &url.Error{Op: "Post", URL: "https://api.firi.com/v2/orders", Err: context.DeadlineExceeded}
+
+// flakyAPI creates orders, but fails the first `failures` posts. With
+// lost set, the failed posts still create the order.
+type flakyAPI struct {
+	failures int
+	lost     bool
+	posts    int
+	orders   firiclient.ActiveOrders
+}
+
+func (f *flakyAPI) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	f.posts++
+	failed := f.posts <= f.failures
+	if failed && !f.lost {
+		return nil, timeout
+	}
+	id := int64(len(f.orders) + 1)
+	f.orders = append(f.orders, firiclient.ActiveOrder{
+		Id: id, Market: r.Market, Type: r.Type, Price: r.Price, Amount: r.Amount, Remaining: r.Amount, CreatedAt: time.Now(),
+	})
+	if failed {
+		return nil, timeout
+	}
+	return &firiclient.CreateOrderResponse{Id: id}, nil
+}
+
+func (f *flakyAPI) GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error) {
+	return f.orders, nil
+}
+
+func (f *flakyAPI) GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	return nil, nil
+}
+
+func newOrder(clientID string) *firiclient.CreateOrderRequest {
+	return &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 100, Amount: 1, ClientOrderID: clientID}
+}
+
+func TestPlacerFindsOrderAfterTimeout(t *testing.T) {
+	ctx := context.Background()
+	api := &flakyAPI{failures: 1, lost: true}
+	p := NewPlacer(api, PlacerConfig{SettleInterval: time.Millisecond})
+
+	res, err := p.PlaceOrder(ctx, newOrder("a"))
+	if err != nil {
+		t.Fatalf("error placing order: %v", err)
+	}
+	if api.posts != 1 || len(api.orders) != 1 || res.Id != 1 {
+		t.Errorf("expected the timed out order to be found without reposting, got posts=%v orders=%v id=%v", api.posts, len(api.orders), res.Id)
+	}
+
+	// placing the same client order id again is a no-op
+	res, err = p.PlaceOrder(ctx, newOrder("a"))
+	if err != nil || res.Id != 1 || api.posts != 1 {
+		t.Errorf("expected existing order for duplicate client order id, got res=%+v err=%v posts=%v", res, err, api.posts)
+	}
+
+	// an identical order with a new client order id must not be matched to the first
+	api.failures = 2
+	res, err = p.PlaceOrder(ctx, newOrder("b"))
+	if err != nil || res.Id != 2 {
+		t.Errorf("expected a second order, got res=%+v err=%v", res, err)
+	}
+	if id, ok := p.Lookup("b"); !ok || id != 2 {
+		t.Errorf("expected b to map to order 2, got %v %v", id, ok)
+	}
+}
+
+func TestPlacerRetriesWhenOrderWasNotCreated(t *testing.T) {
+	api := &flakyAPI{failures: 2}
+	p := NewPlacer(api, PlacerConfig{SettleInterval: time.Millisecond})
+	res, err := p.PlaceOrder(context.Background(), newOrder("a"))
+	if err != nil || res.Id != 1 || api.posts != 3 || len(api.orders) != 1 {
+		t.Errorf("expected one order after retries, got res=%+v err=%v posts=%v orders=%v", res, err, api.posts, len(api.orders))
+	}
+
+	api = &flakyAPI{failures: 5}
+	p = NewPlacer(api, PlacerConfig{Attempts: 2, SettleInterval: time.Millisecond})
+	_, err = p.PlaceOrder(context.Background(), newOrder("a"))
+	if !errors.Is(err, ErrUnknownOutcome) || api.posts != 2 {
+		t.Errorf("expected ErrUnknownOutcome after 2 posts, got err=%v posts=%v", err, api.posts)
+	}
+}
+
+type rejectingAPI struct{ flakyAPI }
+
+func (r *rejectingAPI) PostOrder(ctx context.Context, req *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	r.posts++
+	return nil, &firiclient.APIError{StatusCode: 400}
+}
+
+func TestPlacerDoesNotRetryRejectedOrders(t *testing.T) {
+	api := &rejectingAPI{}
+	p := NewPlacer(api, PlacerConfig{SettleInterval: time.Millisecond})
+	_, err := p.PlaceOrder(context.Background(), newOrder("a"))
+	apiErr := &firiclient.APIError{}
+	if !errors.As(err, &apiErr) || api.posts != 1 {
+		t.Errorf("expected the rejection to be returned after one post, got err=%v posts=%v", err, api.posts)
+	}
+}
+
+// laggingAPI creates orders rounded to a tick, and lists them only after
+// `lag` more listings, like an order still in flight.
+type laggingAPI struct {
+	flakyAPI
+	lag   int
+	lists int
+}
+
+func (l *laggingAPI) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	rounded := *r
+	rounded.Price = math.Round(r.Price*100) / 100
+	l.flakyAPI.PostOrder(ctx, &rounded)
+	return nil, timeout
+}
+
+func (l *laggingAPI) GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error) {
+	l.lists++
+	if l.lists <= l.lag {
+		return nil, nil
+	}
+	return l.orders, nil
+}
+
+func TestPlacerWaitsForOrderInFlight(t *testing.T) {
+	api := &laggingAPI{lag: 2}
+	p := NewPlacer(api, PlacerConfig{SettleInterval: time.Millisecond, PriceTick: 0.01})
+	r := newOrder("a")
+	r.Price = 100.004
+	res, err := p.PlaceOrder(context.Background(), r)
+	if err != nil || res.Id != 1 {
+		t.Fatalf("expected the order in flight to be found, got res=%+v err=%v", res, err)
+	}
+	if api.posts != 1 || api.lists != 3 {
+		t.Errorf("expected 1 post and 3 polls, got posts=%v polls=%v", api.posts, api.lists)
+	}
+}
+
+// failingAPI fails every post with err, and counts the listings made to
+// reconcile.
+type failingAPI struct {
+	flakyAPI
+	err   error
+	lists int
+}
+
+func (f *failingAPI) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	f.posts++
+	return nil, f.err
+}
+
+func (f *failingAPI) GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error) {
+	f.lists++
+	return nil, nil
+}
+
+func TestPlacerOnlyReconcilesAfterSending(t *testing.T) {
+	for _, c := range []struct {
+		err       error
+		ambiguous bool
+	}{
+		{timeout, true},
+		{&firiclient.APIError{StatusCode: 503}, true},
+		{fmt.Errorf("decoding: %w", io.ErrUnexpectedEOF), true},
+		{context.Canceled, false},
+		{&json.UnsupportedValueError{Str: "NaN"}, false},
+		{errors.New("rate limit wait failed"), false},
+	} {
+		api := &failingAPI{err: c.err}
+		p := NewPlacer(api, PlacerConfig{Attempts: 1, SettleInterval: time.Millisecond})
+		_, err := p.PlaceOrder(context.Background(), newOrder("a"))
+		if reconciled := api.lists > 0; reconciled != c.ambiguous {
+			t.Errorf("expected reconciling=%v for %v, got %v", c.ambiguous, c.err, reconciled)
+		}
+		if errors.Is(err, ErrUnknownOutcome) != c.ambiguous {
+			t.Errorf("expected ErrUnknownOutcome=%v for %v, got %v", c.ambiguous, c.err, err)
+		}
+	}
+}
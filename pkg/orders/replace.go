@@ -0,0 +1,85 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var (
+	// ErrOrderNotActive is returned when the order to replace is not an active order.
+	ErrOrderNotActive = errors.New("orders: order is not active")
+	// ErrOrderFilled is returned when the order filled before it was cancelled,
+	// leaving nothing to replace.
+	ErrOrderFilled = errors.New("orders: order filled before it was replaced")
+)
+
+// ReplaceAPI is the part of the private API ReplaceOrder uses.
+type ReplaceAPI interface {
+	GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error)
+	CancelOrder(ctx context.Context, orderId int64, marketId firiclient.MarketID) (*firiclient.ActiveOrder, error)
+	PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error)
+}
+
+type ReplaceResult struct {
+	// Original is the final state of the cancelled order.
+	Original firiclient.ActiveOrder
+	// Amount is the amount of the new order: newAmount less what the
+	// original matched.
+	Amount float64
+	// Order is the new order, or nil if none was placed.
+	Order *firiclient.CreateOrderResponse
+}
+
+// ReplaceOrder emulates amending an order, which Firi does not support. It
+// cancels the order and places a new one on the same side at newPrice.
+//
+// newAmount is the wanted total, so amounts matched by the original count
+// towards it, and the new order is for the rest. The matched amount is taken
+// from the cancel response, which includes fills up to the cancel.
+//
+// If the original filled completely before the cancel, or matched at least
+// newAmount, no order is placed and the error is ErrOrderFilled. If placing
+// the new order fails, the original stays cancelled and the result holds its
+// final state.
+func ReplaceOrder(ctx context.Context, api ReplaceAPI, ref OrderRef, newPrice, newAmount float64) (*ReplaceResult, error) {
+	active, err := api.GetActiveOrdersInMarket(ctx, ref.Market)
+	if err != nil {
+		return nil, err
+	}
+	var original *firiclient.ActiveOrder
+	for i := range active {
+		if active[i].Id == ref.Id {
+			original = &active[i]
+		}
+	}
+	if original == nil {
+		return nil, fmt.Errorf("%w: %v in %v", ErrOrderNotActive, ref.Id, ref.Market)
+	}
+
+	cancelled, err := api.CancelOrder(ctx, ref.Id, ref.Market)
+	if err != nil {
+		return nil, err
+	}
+	res := &ReplaceResult{Original: *cancelled}
+	if cancelled.Cancelled <= 0 {
+		return res, fmt.Errorf("%w: %v matched %v", ErrOrderFilled, ref.Id, cancelled.Matched)
+	}
+	res.Amount = newAmount - cancelled.Matched
+	if res.Amount <= 0 {
+		return res, fmt.Errorf("%w: %v matched %v of %v", ErrOrderFilled, ref.Id, cancelled.Matched, newAmount)
+	}
+
+	res.Order, err = api.PostOrder(ctx, &firiclient.CreateOrderRequest{
+		Market: string(ref.Market),
+		Type:   original.Type,
+		Price:  newPrice,
+		Amount: res.Amount,
+	})
+	if err != nil {
+		return res, fmt.Errorf("orders: cancelled %v, but placing its replacement failed: %w", ref.Id, err)
+	}
+	return res, nil
+}
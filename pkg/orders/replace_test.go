@@ -0,0 +1,66 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/esiqveland/firi/pkg/backtest"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+func restingBid(t *testing.T, ex *backtest.Exchange, price, amount float64) OrderRef {
+	t.Helper()
+	res, err := ex.PostOrder(context.Background(), &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: price, Amount: amount})
+	if err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	return OrderRef{Id: res.Id, Market: firiclient.BTCNOK}
+}
+
+func marketSell(ex *backtest.Exchange, price, amount float64) {
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Trades: firiclient.TradeHistory{
+		{OrderType: firiclient.Ask, Price: price, Amount: amount, CreatedAt: t0},
+	}})
+}
+
+func TestReplaceOrder(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000})
+	ref := restingBid(t, ex, 100, 2)
+	marketSell(ex, 100, 0.5)
+
+	res, err := ReplaceOrder(ctx, ex, ref, 101, 2)
+	if err != nil {
+		t.Fatalf("error replacing order: %v", err)
+	}
+	if res.Original.Matched != 0.5 || res.Amount != 1.5 || res.Order == nil {
+		t.Errorf("expected replacement for the unfilled 1.5, got %+v", res)
+	}
+	active, _ := ex.GetActiveOrdersInMarket(ctx, firiclient.BTCNOK)
+	if len(active) != 1 || active[0].Id != res.Order.Id || active[0].Price != 101 || active[0].Type != firiclient.Bid {
+		t.Errorf("expected only the replacement to be active, got %+v", active)
+	}
+}
+
+func TestReplaceOrderFilled(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000})
+
+	ref := restingBid(t, ex, 100, 1)
+	marketSell(ex, 100, 1)
+	if _, err := ReplaceOrder(ctx, ex, ref, 101, 1); !errors.Is(err, ErrOrderNotActive) {
+		t.Errorf("expected ErrOrderNotActive for a filled order, got %v", err)
+	}
+
+	// a new amount the original already matched leaves nothing to place
+	ref = restingBid(t, ex, 100, 2)
+	marketSell(ex, 100, 1)
+	res, err := ReplaceOrder(ctx, ex, ref, 101, 1)
+	if !errors.Is(err, ErrOrderFilled) || res.Order != nil {
+		t.Errorf("expected ErrOrderFilled without a new order, got res=%+v err=%v", res, err)
+	}
+	if active, _ := ex.GetActiveOrders(ctx); len(active) != 0 {
+		t.Errorf("expected the original to stay cancelled, got %+v", active)
+	}
+}
@@ -0,0 +1,260 @@
+// Package orders tracks, places and manages own orders on top of the private API.
+package orders
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type EventType string
+
+const (
+	EventPlaced          EventType = "placed"
+	EventPartiallyFilled EventType = "partially_filled"
+	EventFilled          EventType = "filled"
+	EventCancelled       EventType = "cancelled"
+)
+
+// Event is a change to one of our orders. Filled is the amount matched since
+// the previous event for the order, and is set on PartiallyFilled and Filled.
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Order  firiclient.ActiveOrder
+	Filled float64
+}
+
+// Source is the part of the private API the tracker polls.
+type Source interface {
+	GetActiveOrders(ctx context.Context) (firiclient.ActiveOrders, error)
+	GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error)
+}
+
+type TrackerConfig struct {
+	Interval time.Duration
+	// MissingPolls is how many polls an order may be missing from both the
+	// active orders and the history, as the history lags behind, before it
+	// is taken to be cancelled. Defaults to 3.
+	MissingPolls int
+}
+
+// Tracker turns successive order snapshots into lifecycle events. The first
+// poll only records the current state; events are emitted for changes after it.
+//
+// Poll and Run must be called from one goroutine, Subscribe from any.
+type Tracker struct {
+	src     Source
+	cfg     TrackerConfig
+	nowFunc func() time.Time
+
+	primed bool
+	open   map[int64]firiclient.ActiveOrder
+	closed map[int64]bool
+	// missing counts the polls open orders have been missing for.
+	missing map[int64]int
+	// gone holds the orders given up on as cancelled, so they are not
+	// reported again if the history has them later.
+	gone map[int64]bool
+
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]func(Event)
+}
+
+func NewTracker(src Source, cfg TrackerConfig) *Tracker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.MissingPolls <= 0 {
+		cfg.MissingPolls = 3
+	}
+	return &Tracker{
+		src:     src,
+		cfg:     cfg,
+		nowFunc: time.Now,
+		open:    map[int64]firiclient.ActiveOrder{},
+		closed:  map[int64]bool{},
+		missing: map[int64]int{},
+		gone:    map[int64]bool{},
+		subs:    map[int]func(Event){},
+	}
+}
+
+// Subscribe registers fn to be called with every event, in order, from the
+// goroutine polling. The returned func removes the subscription.
+func (t *Tracker) Subscribe(fn func(Event)) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.nextID
+	t.nextID++
+	t.subs[id] = fn
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.subs, id)
+	}
+}
+
+// Run polls until ctx is done. Failed polls are logged and retried on the next tick.
+func (t *Tracker) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	tick := time.NewTicker(t.cfg.Interval)
+	defer tick.Stop()
+	for {
+		if _, err := t.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Error().Err(err).Msgf("orders: poll failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// Poll fetches active and closed orders once, and publishes and returns the
+// events since the previous poll.
+//
+// An order that disappears from the active list without showing up in the
+// history is reported as cancelled with its last known state.
+func (t *Tracker) Poll(ctx context.Context) ([]Event, error) {
+	active, err := t.src.GetActiveOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, err := t.src.GetAllFilledAndClosedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := t.nowFunc()
+
+	if !t.primed {
+		t.primed = true
+		for _, o := range active {
+			t.open[o.Id] = o
+		}
+		for _, o := range history {
+			t.closed[o.Id] = true
+		}
+		return nil, nil
+	}
+
+	var events []Event
+	emit := func(typ EventType, o firiclient.ActiveOrder, filled float64) {
+		events = append(events, Event{Type: typ, Time: now, Order: o, Filled: filled})
+	}
+
+	seen := map[int64]bool{}
+	for _, o := range sortOrders(active) {
+		seen[o.Id] = true
+		prev, ok := t.open[o.Id]
+		if !ok {
+			emit(EventPlaced, o, 0)
+		}
+		if d := o.Matched - prev.Matched; d > 0 {
+			emit(EventPartiallyFilled, o, d)
+		}
+		t.open[o.Id] = o
+		delete(t.missing, o.Id)
+	}
+
+	inHistory := map[int64]bool{}
+	for _, o := range sortOrders(history) {
+		inHistory[o.Id] = true
+		if t.closed[o.Id] || seen[o.Id] {
+			continue
+		}
+		t.closed[o.Id] = true
+		if t.gone[o.Id] {
+			delete(t.gone, o.Id)
+			continue
+		}
+		prev, ok := t.open[o.Id]
+		if !ok {
+			emit(EventPlaced, o, 0)
+		}
+		delete(t.open, o.Id)
+		delete(t.missing, o.Id)
+
+		d := o.Matched - prev.Matched
+		if o.Cancelled > 0 || o.Remaining > 0 {
+			if d > 0 {
+				emit(EventPartiallyFilled, o, d)
+			}
+			emit(EventCancelled, o, 0)
+		} else {
+			emit(EventFilled, o, d)
+		}
+	}
+	// ids that dropped out of the history can never be returned again
+	for id := range t.closed {
+		if !inHistory[id] {
+			delete(t.closed, id)
+		}
+	}
+
+	// orders no longer active are kept until the history has them, unless
+	// they stay missing from it
+	var gone []firiclient.ActiveOrder
+	for id, o := range t.open {
+		if seen[id] {
+			continue
+		}
+		t.missing[id]++
+		if t.missing[id] >= t.cfg.MissingPolls {
+			gone = append(gone, o)
+			delete(t.open, id)
+			delete(t.missing, id)
+			t.gone[id] = true
+		}
+	}
+	for _, o := range sortOrders(gone) {
+		emit(EventCancelled, o, 0)
+	}
+
+	t.publish(events)
+	return events, nil
+}
+
+func (t *Tracker) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	t.mu.Lock()
+	ids := make([]int, 0, len(t.subs))
+	for id := range t.subs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subs := make([]func(Event), 0, len(ids))
+	for _, id := range ids {
+		subs = append(subs, t.subs[id])
+	}
+	t.mu.Unlock()
+
+	for _, e := range events {
+		for _, fn := range subs {
+			fn(e)
+		}
+	}
+}
+
+func sortOrders(orders []firiclient.ActiveOrder) []firiclient.ActiveOrder {
+	sorted := append([]firiclient.ActiveOrder(nil), orders...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+	return sorted
+}
@@ -0,0 +1,156 @@
+package orders
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+type fakeSource struct {
+	active  firiclient.ActiveOrders
+	history firiclient.ActiveOrders
+}
+
+func (f *fakeSource) GetActiveOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	return f.active, nil
+}
+
+func (f *fakeSource) GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	return f.history, nil
+}
+
+func order(id int64, amount, matched, cancelled float64) firiclient.ActiveOrder {
+	return firiclient.ActiveOrder{
+		Id:        id,
+		Market:    "BTCNOK",
+		Type:      firiclient.Bid,
+		Price:     100,
+		Amount:    amount,
+		Matched:   matched,
+		Cancelled: cancelled,
+		Remaining: amount - matched - cancelled,
+		CreatedAt: t0.Add(time.Duration(id) * time.Second),
+	}
+}
+
+type want struct {
+	typ    EventType
+	id     int64
+	filled float64
+}
+
+func check(t *testing.T, got []Event, expected ...want) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v events, got %+v", len(expected), got)
+	}
+	for i, w := range expected {
+		e := got[i]
+		if e.Type != w.typ || e.Order.Id != w.id || e.Filled != w.filled {
+			t.Errorf("event %v: expected %+v, got type=%v id=%v filled=%v", i, w, e.Type, e.Order.Id, e.Filled)
+		}
+	}
+}
+
+func TestTrackerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	src := &fakeSource{
+		active:  firiclient.ActiveOrders{order(1, 2, 0, 0)},
+		history: firiclient.ActiveOrders{order(9, 1, 1, 0)},
+	}
+	tr := NewTracker(src, TrackerConfig{})
+	var published []Event
+	tr.Subscribe(func(e Event) { published = append(published, e) })
+
+	events, err := tr.Poll(ctx)
+	if err != nil {
+		t.Fatalf("error polling: %v", err)
+	}
+	check(t, events)
+
+	// order 1 fills partially, order 2 is placed, order 3 is placed and filled between polls
+	src.active = firiclient.ActiveOrders{order(1, 2, 0.5, 0), order(2, 1, 0, 0)}
+	src.history = firiclient.ActiveOrders{order(3, 1, 1, 0), order(9, 1, 1, 0)}
+	events, _ = tr.Poll(ctx)
+	check(t, events,
+		want{EventPartiallyFilled, 1, 0.5},
+		want{EventPlaced, 2, 0},
+		want{EventPlaced, 3, 0},
+		want{EventFilled, 3, 1},
+	)
+
+	// order 1 fills completely, order 2 is cancelled after a partial fill
+	src.active = nil
+	src.history = firiclient.ActiveOrders{order(1, 2, 2, 0), order(2, 1, 0.25, 0.75), order(3, 1, 1, 0)}
+	events, _ = tr.Poll(ctx)
+	check(t, events,
+		want{EventFilled, 1, 1.5},
+		want{EventPartiallyFilled, 2, 0.25},
+		want{EventCancelled, 2, 0},
+	)
+
+	events, _ = tr.Poll(ctx)
+	check(t, events)
+	if len(published) != 7 {
+		t.Errorf("expected subscriber to get 7 events, got %v", len(published))
+	}
+}
+
+func TestTrackerMissingOrderIsCancelled(t *testing.T) {
+	ctx := context.Background()
+	src := &fakeSource{active: firiclient.ActiveOrders{order(1, 1, 0, 0)}}
+	tr := NewTracker(src, TrackerConfig{})
+	tr.Poll(ctx)
+
+	// an order missing from the history is only taken to be cancelled after MissingPolls polls
+	src.active = nil
+	for i := 0; i < 2; i++ {
+		events, _ := tr.Poll(ctx)
+		check(t, events)
+	}
+	events, _ := tr.Poll(ctx)
+	check(t, events, want{EventCancelled, 1, 0})
+
+	// the order turning up in the history later is not reported again
+	src.history = firiclient.ActiveOrders{order(1, 1, 1, 0)}
+	events, _ = tr.Poll(ctx)
+	check(t, events)
+}
+
+func TestTrackerWaitsForLaggingHistory(t *testing.T) {
+	ctx := context.Background()
+	src := &fakeSource{active: firiclient.ActiveOrders{order(1, 1, 0, 0)}}
+	tr := NewTracker(src, TrackerConfig{})
+	tr.Poll(ctx)
+
+	// the order fills, but the history does not have it yet
+	src.active = nil
+	events, _ := tr.Poll(ctx)
+	check(t, events)
+
+	src.history = firiclient.ActiveOrders{order(1, 1, 1, 0)}
+	events, _ = tr.Poll(ctx)
+	check(t, events, want{EventFilled, 1, 1})
+}
+
+func TestTrackerUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	src := &fakeSource{}
+	tr := NewTracker(src, TrackerConfig{})
+	tr.Poll(ctx)
+
+	calls := 0
+	unsubscribe := tr.Subscribe(func(e Event) { calls++ })
+	src.active = firiclient.ActiveOrders{order(1, 1, 0, 0)}
+	tr.Poll(ctx)
+	unsubscribe()
+	src.active = nil
+	tr.Poll(ctx)
+	if calls != 1 {
+		t.Errorf("expected 1 call before unsubscribing, got %v", calls)
+	}
+}
@@ -0,0 +1,247 @@
+// Package paper implements firiclient.PrivateAPI for paper trading: market
+// data comes from the real public API, while orders, fills and balances are
+// simulated locally by a backtest.Exchange.
+package paper
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/esiqveland/firi/pkg/backtest"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type Config struct {
+	// Balances are the starting balances, e.g. {"NOK": 100000}.
+	Balances map[string]float64
+	Fees     backtest.FeeRates
+	// Markets are refreshed by Run even without any calls, so resting
+	// orders fill while nobody is looking.
+	Markets []firiclient.MarketID
+	// MaxAge is how old market data may get before a call refreshes it.
+	// Defaults to 2s.
+	MaxAge time.Duration
+}
+
+// Client is a paper trading client. Public calls go to the real API. Private
+// calls first bring the simulated market up to date with the real orderbook
+// and the market trades since the last refresh, which fill resting orders.
+type Client struct {
+	firiclient.PublicAPI
+	ex      *backtest.Exchange
+	cfg     Config
+	nowFunc func() time.Time
+
+	mu      sync.Mutex
+	markets map[firiclient.MarketID]*marketState
+}
+
+type marketState struct {
+	refreshed time.Time
+	// newest is the time of the newest trade applied, and seen the trades at
+	// that time, as the trade history has no ids.
+	newest time.Time
+	seen   map[tradeKey]bool
+}
+
+type tradeKey struct {
+	at     int64
+	typ    firiclient.OrderType
+	price  float64
+	amount float64
+}
+
+func New(public firiclient.PublicAPI, cfg Config) *Client {
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 2 * time.Second
+	}
+	c := &Client{
+		PublicAPI: public,
+		ex:        backtest.NewExchange(cfg.Fees, cfg.Balances),
+		cfg:       cfg,
+		nowFunc:   time.Now,
+		markets:   map[firiclient.MarketID]*marketState{},
+	}
+	for _, m := range cfg.Markets {
+		c.markets[m] = nil
+	}
+	return c
+}
+
+var _ firiclient.PrivateAPI = (*Client)(nil)
+
+// Exchange returns the simulated exchange, e.g. for its Equity.
+func (c *Client) Exchange() *backtest.Exchange {
+	return c.ex
+}
+
+// Run refreshes the configured markets every MaxAge until ctx is done.
+// Failed refreshes are logged and retried on the next tick.
+func (c *Client) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	t := time.NewTicker(c.cfg.MaxAge)
+	defer t.Stop()
+	for {
+		for _, m := range c.cfg.Markets {
+			if err := c.refresh(ctx, m, true); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msgf("paper: refreshing %v failed: %v", m, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// refresh applies the real orderbook and new market trades of market to the
+// simulated exchange, unless they were applied less than MaxAge ago. The
+// first refresh of a market only applies the orderbook, as earlier trades
+// cannot fill any order. Market data is fetched without holding the lock, so
+// other markets are not held up by the round trip.
+func (c *Client) refresh(ctx context.Context, market firiclient.MarketID, force bool) error {
+	c.mu.Lock()
+	now := c.nowFunc()
+	s := c.markets[market]
+	fresh := s != nil && !force && now.Sub(s.refreshed) < c.cfg.MaxAge
+	c.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	book, err := c.PublicAPI.GetOrderbookV2(ctx, market)
+	if err != nil {
+		return err
+	}
+	history, err := c.PublicAPI.GetMarketTradeHistoryV2(ctx, market)
+	if err != nil {
+		return err
+	}
+	history = append(firiclient.TradeHistory(nil), history...)
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].CreatedAt.Before(history[j].CreatedAt)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s = c.markets[market]
+	if s != nil && s.refreshed.After(now) {
+		// a concurrent refresh applied newer data meanwhile
+		return nil
+	}
+	var trades firiclient.TradeHistory
+	if s == nil {
+		s = &marketState{seen: map[tradeKey]bool{}}
+		for _, t := range history {
+			s.see(t)
+		}
+		c.markets[market] = s
+	} else {
+		for _, t := range history {
+			if s.see(t) {
+				trades = append(trades, t)
+			}
+		}
+	}
+	s.refreshed = now
+	c.ex.Apply(backtest.Event{Time: now, Market: market, Orderbook: book, Trades: trades})
+	return nil
+}
+
+// see reports whether t is newer than the trades seen before. Trades must be
+// seen oldest first.
+func (s *marketState) see(t firiclient.HistoricOrder) bool {
+	k := tradeKey{at: t.CreatedAt.UnixNano(), typ: t.OrderType, price: t.Price, amount: t.Amount}
+	switch {
+	case t.CreatedAt.Before(s.newest) || s.seen[k]:
+		return false
+	case t.CreatedAt.After(s.newest):
+		s.newest = t.CreatedAt
+		s.seen = map[tradeKey]bool{}
+	}
+	s.seen[k] = true
+	return true
+}
+
+// refreshAll refreshes every market configured or traded in.
+func (c *Client) refreshAll(ctx context.Context) error {
+	c.mu.Lock()
+	markets := make([]firiclient.MarketID, 0, len(c.markets))
+	for m := range c.markets {
+		markets = append(markets, m)
+	}
+	c.mu.Unlock()
+	for _, m := range markets {
+		if err := c.refresh(ctx, m, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) GetActiveOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	if err := c.refreshAll(ctx); err != nil {
+		return nil, err
+	}
+	return c.ex.GetActiveOrders(ctx)
+}
+
+func (c *Client) GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	if err := c.refreshAll(ctx); err != nil {
+		return nil, err
+	}
+	return c.ex.GetAllFilledAndClosedOrders(ctx)
+}
+
+func (c *Client) GetAllTrades(ctx context.Context) (firiclient.HistoricTrades, error) {
+	if err := c.refreshAll(ctx); err != nil {
+		return nil, err
+	}
+	return c.ex.GetAllTrades(ctx)
+}
+
+func (c *Client) GetActiveOrdersInMarket(ctx context.Context, marketId firiclient.MarketID) (firiclient.ActiveOrders, error) {
+	if err := c.refresh(ctx, marketId, false); err != nil {
+		return nil, err
+	}
+	return c.ex.GetActiveOrdersInMarket(ctx, marketId)
+}
+
+func (c *Client) DeleteAllOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	if err := c.refreshAll(ctx); err != nil {
+		return nil, err
+	}
+	return c.ex.DeleteAllOrders(ctx)
+}
+
+func (c *Client) CancelOrder(ctx context.Context, orderId int64, marketId firiclient.MarketID) (*firiclient.ActiveOrder, error) {
+	if err := c.refresh(ctx, marketId, false); err != nil {
+		return nil, err
+	}
+	return c.ex.CancelOrder(ctx, orderId, marketId)
+}
+
+// PostOrder matches the order against the real orderbook, and rests what is
+// left until real market trades cross it.
+func (c *Client) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	if err := c.refresh(ctx, firiclient.MarketID(r.Market), false); err != nil {
+		return nil, err
+	}
+	return c.ex.PostOrder(ctx, r)
+}
+
+func (c *Client) PostWithdrawal(ctx context.Context, coinId string, r *firiclient.CreateWithdrawalRequest) (*firiclient.CreateWithdrawalResponse, error) {
+	return c.ex.PostWithdrawal(ctx, coinId, r)
+}
+
+func (c *Client) GetBalancesV2(ctx context.Context) (firiclient.Balances, error) {
+	if err := c.refreshAll(ctx); err != nil {
+		return nil, err
+	}
+	return c.ex.GetBalancesV2(ctx)
+}
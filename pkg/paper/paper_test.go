@@ -0,0 +1,119 @@
+package paper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+type fakePublic struct {
+	firiclient.PublicAPI
+	history firiclient.TradeHistory
+	books   int
+}
+
+func (f *fakePublic) GetOrderbookV2(ctx context.Context, marketId firiclient.MarketID) (*firiclient.Orderbook, error) {
+	f.books++
+	return &firiclient.Orderbook{
+		Bids: []firiclient.Order{{Price: 99, Quantity: 1}},
+		Asks: []firiclient.Order{{Price: 101, Quantity: 1}},
+	}, nil
+}
+
+func (f *fakePublic) GetMarketTradeHistoryV2(ctx context.Context, marketId firiclient.MarketID) (firiclient.TradeHistory, error) {
+	return f.history, nil
+}
+
+func sell(sec int, price, amount float64) firiclient.HistoricOrder {
+	return firiclient.HistoricOrder{OrderType: firiclient.Ask, Price: price, Amount: amount, CreatedAt: t0.Add(time.Duration(sec) * time.Second)}
+}
+
+func TestPaperTrading(t *testing.T) {
+	ctx := context.Background()
+	now := t0
+	// an old trade that would fill the bid must not be replayed
+	public := &fakePublic{history: firiclient.TradeHistory{sell(-1, 90, 5)}}
+	c := New(public, Config{Balances: map[string]float64{"NOK": 1000}})
+	c.nowFunc = func() time.Time { return now }
+
+	res, err := c.PostOrder(ctx, &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: 100, Amount: 2})
+	if err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	active, _ := c.GetActiveOrders(ctx)
+	if len(active) != 1 || active[0].Id != res.Id || active[0].Matched != 0 {
+		t.Fatalf("expected a resting order, got %+v", active)
+	}
+	if public.books != 1 {
+		t.Errorf("expected fresh data to be reused, fetched %v books", public.books)
+	}
+
+	// new trades cross the order once the data is refreshed
+	public.history = firiclient.TradeHistory{sell(2, 100, 0.5), sell(1, 100, 0.5), sell(-1, 90, 5)}
+	now = now.Add(3 * time.Second)
+	active, _ = c.GetActiveOrders(ctx)
+	if len(active) != 1 || active[0].Matched != 1 {
+		t.Fatalf("expected 1 matched by new trades, got %+v", active)
+	}
+
+	// trades already applied are not applied again
+	public.history = append(firiclient.TradeHistory{sell(3, 100, 0.25)}, public.history...)
+	now = now.Add(3 * time.Second)
+	active, _ = c.GetActiveOrders(ctx)
+	if len(active) != 1 || active[0].Matched != 1.25 {
+		t.Fatalf("expected only the newest trade to match, got %+v", active)
+	}
+
+	balances, _ := c.GetBalancesV2(ctx)
+	for _, b := range balances {
+		if b.Currency == "BTC" && b.Balance != 1.25 {
+			t.Errorf("expected 1.25 BTC, got %+v", b)
+		}
+	}
+}
+
+type blockingPublic struct {
+	fakePublic
+	blocked firiclient.MarketID
+	release chan struct{}
+}
+
+func (f *blockingPublic) GetOrderbookV2(ctx context.Context, marketId firiclient.MarketID) (*firiclient.Orderbook, error) {
+	if marketId == f.blocked {
+		<-f.release
+	}
+	return f.fakePublic.GetOrderbookV2(ctx, marketId)
+}
+
+func TestRefreshDoesNotBlockOtherMarkets(t *testing.T) {
+	ctx := context.Background()
+	public := &blockingPublic{blocked: firiclient.ETHNOK, release: make(chan struct{})}
+	c := New(public, Config{Balances: map[string]float64{"NOK": 1000}})
+
+	done := make(chan error)
+	go func() { done <- c.refresh(ctx, firiclient.ETHNOK, false) }()
+	// wait until the blocked refresh is inside the round trip
+	time.Sleep(10 * time.Millisecond)
+
+	refreshed := make(chan error)
+	go func() {
+		_, err := c.GetActiveOrdersInMarket(ctx, firiclient.BTCNOK)
+		refreshed <- err
+	}()
+	select {
+	case err := <-refreshed:
+		if err != nil {
+			t.Errorf("error refreshing BTCNOK: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected BTCNOK to refresh while ETHNOK is fetching")
+	}
+	close(public.release)
+	if err := <-done; err != nil {
+		t.Errorf("error refreshing ETHNOK: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileSuffix = ".jsonl.gz"
+
+type WriterConfig struct {
+	Dir string
+	// MaxBytes rotates the file after this many uncompressed bytes. Zero means no limit.
+	MaxBytes int64
+	// MaxAge rotates the file after it has been open this long. Zero means no limit.
+	MaxAge time.Duration
+}
+
+// Writer writes records as gzipped JSON lines, rotating to a new file by size and age.
+// Files are named by their UTC creation time, so they sort in recording order.
+type Writer struct {
+	mu      sync.Mutex
+	cfg     WriterConfig
+	file    *os.File
+	gz      *gzip.Writer
+	written int64
+	opened  time.Time
+	nowFunc func() time.Time
+}
+
+func NewWriter(cfg WriterConfig) (*Writer, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{cfg: cfg, nowFunc: time.Now}, nil
+}
+
+func (w *Writer) Write(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.shouldRotate(int64(len(data))) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.gz.Write(data)
+	w.written += int64(n)
+	return err
+}
+
+func (w *Writer) shouldRotate(next int64) bool {
+	if w.gz == nil {
+		return true
+	}
+	if w.cfg.MaxBytes > 0 && w.written > 0 && w.written+next > w.cfg.MaxBytes {
+		return true
+	}
+	if w.cfg.MaxAge > 0 && w.nowFunc().Sub(w.opened) >= w.cfg.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (w *Writer) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	now := w.nowFunc().UTC()
+	name := filepath.Join(w.cfg.Dir, "firi-"+now.Format("20060102T150405.000000000Z")+fileSuffix)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.gz = gzip.NewWriter(f)
+	w.written = 0
+	w.opened = now
+	return nil
+}
+
+func (w *Writer) closeFile() error {
+	if w.gz == nil {
+		return nil
+	}
+	err := w.gz.Close()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.gz = nil
+	w.file = nil
+	return err
+}
+
+// Flush writes what is buffered to the current file, so it can be read back
+// even if the file is never closed.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Flush()
+}
+
+// Close flushes and closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+// Reader replays all recorded files in a directory in recording order.
+type Reader struct {
+	files []string
+	file  *os.File
+	gz    *gzip.Reader
+	dec   *json.Decoder
+}
+
+func OpenReader(dir string) (*Reader, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), fileSuffix) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return &Reader{files: files}, nil
+}
+
+// Next returns the next record, or io.EOF when all files are read.
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.dec == nil {
+			if len(r.files) == 0 {
+				return Record{}, io.EOF
+			}
+			if err := r.open(r.files[0]); err != nil {
+				return Record{}, err
+			}
+			r.files = r.files[1:]
+		}
+		rec := Record{}
+		err := r.dec.Decode(&rec)
+		if err == nil {
+			return rec, nil
+		}
+		// a file cut short by a crash ends with a partial record; move on to the next file
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if err := r.closeFile(); err != nil {
+				return Record{}, err
+			}
+			continue
+		}
+		return Record{}, fmt.Errorf("recorder: error reading %v: %w", r.file.Name(), err)
+	}
+}
+
+func (r *Reader) open(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("recorder: error reading %v: %w", name, err)
+	}
+	r.file = f
+	r.gz = gz
+	r.dec = json.NewDecoder(gz)
+	return nil
+}
+
+func (r *Reader) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	r.gz.Close()
+	err := r.file.Close()
+	r.file, r.gz, r.dec = nil, nil, nil
+	return err
+}
+
+func (r *Reader) Close() error {
+	return r.closeFile()
+}
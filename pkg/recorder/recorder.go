@@ -0,0 +1,169 @@
+// Package recorder periodically captures public market data into compressed,
+// rotating JSON lines files, and reads them back for replay.
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type Kind string
+
+const (
+	KindOrderbook Kind = "orderbook"
+	KindTickers   Kind = "tickers"
+	KindTrades    Kind = "trades"
+)
+
+// Record is one captured observation. Trades records only hold trades not
+// seen in earlier polls.
+type Record struct {
+	Time      time.Time                `json:"time"`
+	Kind      Kind                     `json:"kind"`
+	Market    firiclient.MarketID      `json:"market,omitempty"`
+	Orderbook *firiclient.Orderbook    `json:"orderbook,omitempty"`
+	Tickers   firiclient.MarketTickers `json:"tickers,omitempty"`
+	Trades    firiclient.TradeHistory  `json:"trades,omitempty"`
+}
+
+type Config struct {
+	Markets  []firiclient.MarketID
+	Interval time.Duration
+}
+
+type Recorder struct {
+	api     firiclient.PublicAPI
+	cfg     Config
+	w       *Writer
+	dedup   map[firiclient.MarketID]*tradeDedup
+	nowFunc func() time.Time
+}
+
+func New(api firiclient.PublicAPI, w *Writer, cfg Config) *Recorder {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	dedup := map[firiclient.MarketID]*tradeDedup{}
+	for _, m := range cfg.Markets {
+		dedup[m] = newTradeDedup()
+	}
+	return &Recorder{
+		api:     api,
+		cfg:     cfg,
+		w:       w,
+		dedup:   dedup,
+		nowFunc: time.Now,
+	}
+}
+
+// Run polls until ctx is done. Failed polls are logged and retried on the next tick.
+func (r *Recorder) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	t := time.NewTicker(r.cfg.Interval)
+	defer t.Stop()
+	for {
+		if err := r.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Error().Err(err).Msgf("recorder: poll failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Poll captures tickers, and the orderbook and new trades of every configured
+// market, once. A market that fails does not stop the others; all failures
+// are returned joined. What was written is flushed, so a crash loses at most
+// the poll in progress.
+func (r *Recorder) Poll(ctx context.Context) error {
+	var errs []error
+	if tickers, err := r.api.GetMarketTickersV2(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("recorder: tickers: %w", err))
+	} else if err := r.w.Write(&Record{Time: r.nowFunc(), Kind: KindTickers, Tickers: tickers}); err != nil {
+		errs = append(errs, err)
+	}
+	for _, m := range r.cfg.Markets {
+		if err := r.pollMarket(ctx, m); err != nil {
+			errs = append(errs, fmt.Errorf("recorder: %v: %w", m, err))
+		}
+	}
+	errs = append(errs, r.w.Flush())
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) pollMarket(ctx context.Context, m firiclient.MarketID) error {
+	book, err := r.api.GetOrderbookV2(ctx, m)
+	if err != nil {
+		return err
+	}
+	err = r.w.Write(&Record{Time: r.nowFunc(), Kind: KindOrderbook, Market: m, Orderbook: book})
+	if err != nil {
+		return err
+	}
+
+	history, err := r.api.GetMarketTradeHistoryV2(ctx, m)
+	if err != nil {
+		return err
+	}
+	fresh := r.dedup[m].filter(history)
+	if len(fresh) == 0 {
+		return nil
+	}
+	return r.w.Write(&Record{Time: r.nowFunc(), Kind: KindTrades, Market: m, Trades: fresh})
+}
+
+// tradeKey identifies a trade, as the public history has no trade ids.
+type tradeKey struct {
+	at     int64
+	typ    firiclient.OrderType
+	price  float64
+	amount float64
+}
+
+// tradeDedup remembers trades of the previous poll. The history endpoint
+// returns a sliding window of the latest trades, so keys older than the
+// window can never be returned again and are forgotten.
+type tradeDedup struct {
+	seen map[tradeKey]time.Time
+}
+
+func newTradeDedup() *tradeDedup {
+	return &tradeDedup{seen: map[tradeKey]time.Time{}}
+}
+
+func (d *tradeDedup) filter(history firiclient.TradeHistory) firiclient.TradeHistory {
+	var fresh firiclient.TradeHistory
+	var oldest time.Time
+	for _, t := range history {
+		if oldest.IsZero() || t.CreatedAt.Before(oldest) {
+			oldest = t.CreatedAt
+		}
+		k := tradeKey{at: t.CreatedAt.UnixNano(), typ: t.OrderType, price: t.Price, amount: t.Amount}
+		if _, ok := d.seen[k]; ok {
+			continue
+		}
+		d.seen[k] = t.CreatedAt
+		fresh = append(fresh, t)
+	}
+	for k, at := range d.seen {
+		if at.Before(oldest) {
+			delete(d.seen, k)
+		}
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].CreatedAt.Before(fresh[j].CreatedAt)
+	})
+	return fresh
+}
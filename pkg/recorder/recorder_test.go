@@ -0,0 +1,129 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+type fakeAPI struct {
+	firiclient.PublicAPI
+	history firiclient.TradeHistory
+	// failing markets return an error for their orderbook
+	failing firiclient.MarketID
+}
+
+func (f *fakeAPI) GetMarketTickersV2(ctx context.Context) (firiclient.MarketTickers, error) {
+	return firiclient.MarketTickers{{MarketID: "BTCNOK", Bid: 99, Ask: 101}}, nil
+}
+
+func (f *fakeAPI) GetOrderbookV2(ctx context.Context, marketId firiclient.MarketID) (*firiclient.Orderbook, error) {
+	if marketId == f.failing {
+		return nil, errors.New("unavailable")
+	}
+	return &firiclient.Orderbook{
+		Bids: []firiclient.Order{{Price: 99, Quantity: 1}},
+		Asks: []firiclient.Order{{Price: 101, Quantity: 1}},
+	}, nil
+}
+
+func (f *fakeAPI) GetMarketTradeHistoryV2(ctx context.Context, marketId firiclient.MarketID) (firiclient.TradeHistory, error) {
+	return f.history, nil
+}
+
+func trade(sec int, price float64) firiclient.HistoricOrder {
+	return firiclient.HistoricOrder{OrderType: firiclient.Bid, Price: price, Amount: 1, CreatedAt: t0.Add(time.Duration(sec) * time.Second)}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(WriterConfig{Dir: dir, MaxBytes: 200})
+	if err != nil {
+		t.Fatalf("error creating writer: %v", err)
+	}
+	api := &fakeAPI{history: firiclient.TradeHistory{trade(2, 101), trade(1, 100)}}
+	r := New(api, w, Config{Markets: []firiclient.MarketID{firiclient.BTCNOK}})
+	ctx := context.Background()
+
+	if err := r.Poll(ctx); err != nil {
+		t.Fatalf("error polling: %v", err)
+	}
+	// the window slides: trade 1 drops out, trade 2 is repeated and trade 3 is new
+	api.history = firiclient.TradeHistory{trade(3, 102), trade(2, 101)}
+	if err := r.Poll(ctx); err != nil {
+		t.Fatalf("error polling: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing writer: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) < 2 {
+		t.Errorf("expected files to rotate, got %v files", len(entries))
+	}
+
+	reader, err := OpenReader(dir)
+	if err != nil {
+		t.Fatalf("error opening reader: %v", err)
+	}
+	defer reader.Close()
+	var trades firiclient.TradeHistory
+	kinds := map[Kind]int{}
+	for {
+		rec, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading: %v", err)
+		}
+		kinds[rec.Kind]++
+		trades = append(trades, rec.Trades...)
+	}
+	if kinds[KindTickers] != 2 || kinds[KindOrderbook] != 2 || kinds[KindTrades] != 2 {
+		t.Errorf("unexpected records=%v", kinds)
+	}
+	if len(trades) != 3 || trades[0].Price != 100 || trades[2].Price != 102 {
+		t.Errorf("unexpected replayed trades=%+v", trades)
+	}
+}
+
+func TestPollContinuesPastFailedMarketAndFlushes(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := NewWriter(WriterConfig{Dir: dir})
+	api := &fakeAPI{failing: firiclient.ETHNOK}
+	r := New(api, w, Config{Markets: []firiclient.MarketID{firiclient.ETHNOK, firiclient.BTCNOK}})
+	if err := r.Poll(context.Background()); err == nil {
+		t.Errorf("expected the ETHNOK failure to be returned")
+	}
+
+	// read back without closing the writer, as after a crash
+	reader, err := OpenReader(dir)
+	if err != nil {
+		t.Fatalf("error opening reader: %v", err)
+	}
+	defer reader.Close()
+	var markets []firiclient.MarketID
+	for {
+		rec, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading: %v", err)
+		}
+		if rec.Kind == KindOrderbook {
+			markets = append(markets, rec.Market)
+		}
+	}
+	if len(markets) != 1 || markets[0] != firiclient.BTCNOK {
+		t.Errorf("expected the BTCNOK orderbook to be recorded and readable, got %v", markets)
+	}
+}
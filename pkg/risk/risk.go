@@ -0,0 +1,286 @@
+// Package risk guards order placement with pre-trade limits and a kill switch.
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var (
+	ErrKilled        = errors.New("risk: kill switch is engaged")
+	ErrMaxAmount     = errors.New("risk: order amount above limit")
+	ErrMaxNotional   = errors.New("risk: order notional above limit")
+	ErrMaxOpenOrders = errors.New("risk: too many open orders")
+	ErrPriceBand     = errors.New("risk: order price outside band")
+	ErrDailyLoss     = errors.New("risk: daily loss limit reached")
+	ErrNoPrice       = errors.New("risk: no price for held currency")
+)
+
+// MarketLimits bound single orders in a market. Zero means no limit.
+type MarketLimits struct {
+	// MaxAmount is the largest order amount, in the base currency.
+	MaxAmount float64
+	// MaxNotional is the largest order value, price times amount, in NOK.
+	MaxNotional float64
+}
+
+type Limits struct {
+	// Markets holds per market limits. Markets not in it get Default.
+	Markets map[firiclient.MarketID]MarketLimits
+	Default MarketLimits
+	// MaxOpenOrders caps open orders across all markets. Zero means no limit.
+	MaxOpenOrders int
+	// PriceBand rejects orders priced further than this fraction through
+	// the other side of the book: bids above ask*(1+band) and asks below
+	// bid*(1-band). Zero disables the check.
+	PriceBand float64
+	// MaxDailyLoss engages the kill switch once equity in NOK has fallen
+	// this much since the start of the day. Equity is snapshot when the day
+	// starts by Run, or else at the first order of the day, and checked
+	// before every order and by Run. Deposits and withdrawals count as gains
+	// and losses. Zero disables the check.
+	MaxDailyLoss float64
+	// CheckInterval is how often Run checks the daily loss. Defaults to 1m.
+	CheckInterval time.Duration
+	// Location decides when a day starts. Defaults to Europe/Oslo.
+	Location *time.Location
+}
+
+// Guard wraps a PrivateAPI, checking every order against the limits before
+// passing it on. Rejected orders never reach the wrapped API. Orders are
+// checked and placed one at a time, so concurrent orders cannot all pass the
+// same open order count, and Kill waits for an order being placed.
+type Guard struct {
+	firiclient.PrivateAPI
+	limits  Limits
+	nowFunc func() time.Time
+
+	// placing is held while checking and placing an order, and by Kill.
+	placing sync.Mutex
+
+	mu         sync.Mutex
+	killed     bool
+	reason     string
+	day        time.Time
+	dayEquity  float64
+	haveEquity bool
+}
+
+func New(api firiclient.PrivateAPI, limits Limits) *Guard {
+	if limits.Location == nil {
+		loc, err := time.LoadLocation("Europe/Oslo")
+		if err != nil {
+			loc = time.UTC
+		}
+		limits.Location = loc
+	}
+	if limits.CheckInterval <= 0 {
+		limits.CheckInterval = time.Minute
+	}
+	return &Guard{PrivateAPI: api, limits: limits, nowFunc: time.Now}
+}
+
+// Kill engages the kill switch, blocking new orders, and cancels all open
+// orders, including one being placed.
+func (g *Guard) Kill(ctx context.Context, reason string) error {
+	g.placing.Lock()
+	defer g.placing.Unlock()
+	return g.kill(ctx, reason)
+}
+
+func (g *Guard) kill(ctx context.Context, reason string) error {
+	g.mu.Lock()
+	g.killed = true
+	g.reason = reason
+	g.mu.Unlock()
+	zerolog.Ctx(ctx).Warn().Msgf("risk: kill switch engaged: %v", reason)
+	_, err := g.PrivateAPI.DeleteAllOrders(ctx)
+	return err
+}
+
+// Reset disengages the kill switch.
+func (g *Guard) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.killed = false
+	g.reason = ""
+}
+
+// Killed reports whether the kill switch is engaged, and why.
+func (g *Guard) Killed() (bool, string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.killed, g.reason
+}
+
+func (g *Guard) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	g.placing.Lock()
+	defer g.placing.Unlock()
+	if err := g.check(ctx, r); err != nil {
+		return nil, err
+	}
+	if killed, reason := g.Killed(); killed {
+		return nil, fmt.Errorf("%w: %v", ErrKilled, reason)
+	}
+	return g.PrivateAPI.PostOrder(ctx, r)
+}
+
+// Check runs the pre-trade checks for r without placing it.
+func (g *Guard) Check(ctx context.Context, r *firiclient.CreateOrderRequest) error {
+	g.placing.Lock()
+	defer g.placing.Unlock()
+	return g.check(ctx, r)
+}
+
+func (g *Guard) check(ctx context.Context, r *firiclient.CreateOrderRequest) error {
+	if killed, reason := g.Killed(); killed {
+		return fmt.Errorf("%w: %v", ErrKilled, reason)
+	}
+
+	market := firiclient.MarketID(r.Market)
+	limits, ok := g.limits.Markets[market]
+	if !ok {
+		limits = g.limits.Default
+	}
+	if limits.MaxAmount > 0 && r.Amount > limits.MaxAmount {
+		return fmt.Errorf("%w: %v > %v in %v", ErrMaxAmount, r.Amount, limits.MaxAmount, market)
+	}
+	if notional := r.Price * r.Amount; limits.MaxNotional > 0 && notional > limits.MaxNotional {
+		return fmt.Errorf("%w: %v > %v in %v", ErrMaxNotional, notional, limits.MaxNotional, market)
+	}
+
+	if g.limits.MaxOpenOrders > 0 {
+		open, err := g.PrivateAPI.GetActiveOrders(ctx)
+		if err != nil {
+			return err
+		}
+		if len(open) >= g.limits.MaxOpenOrders {
+			return fmt.Errorf("%w: %v open", ErrMaxOpenOrders, len(open))
+		}
+	}
+
+	if g.limits.PriceBand > 0 {
+		t, err := g.PrivateAPI.GetMarketTickerV2(ctx, market)
+		if err != nil {
+			return err
+		}
+		if r.Type == firiclient.Bid && t.Ask > 0 && r.Price > t.Ask*(1+g.limits.PriceBand) {
+			return fmt.Errorf("%w: bid %v above ask %v", ErrPriceBand, r.Price, t.Ask)
+		}
+		if r.Type == firiclient.Ask && t.Bid > 0 && r.Price < t.Bid*(1-g.limits.PriceBand) {
+			return fmt.Errorf("%w: ask %v below bid %v", ErrPriceBand, r.Price, t.Bid)
+		}
+	}
+
+	if g.limits.MaxDailyLoss > 0 {
+		return g.checkDailyLoss(ctx)
+	}
+	return nil
+}
+
+// Run checks the daily loss every CheckInterval and at the start of every
+// day, so held positions that fall trip the kill switch without any orders
+// being placed. Failed checks are logged and retried on the next tick.
+func (g *Guard) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+	if g.limits.MaxDailyLoss <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for {
+		g.placing.Lock()
+		err := g.checkDailyLoss(ctx)
+		g.placing.Unlock()
+		if err != nil && ctx.Err() == nil && !errors.Is(err, ErrDailyLoss) {
+			log.Error().Err(err).Msgf("risk: checking daily loss failed: %v", err)
+		}
+
+		wait := g.limits.CheckInterval
+		if untilDay := g.dayStart(g.nowFunc()).AddDate(0, 0, 1).Sub(g.nowFunc()); untilDay < wait {
+			wait = untilDay
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (g *Guard) dayStart(t time.Time) time.Time {
+	t = t.In(g.limits.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, g.limits.Location)
+}
+
+func (g *Guard) checkDailyLoss(ctx context.Context) error {
+	equity, err := g.equity(ctx)
+	if err != nil {
+		return err
+	}
+	day := g.dayStart(g.nowFunc())
+
+	g.mu.Lock()
+	if !g.haveEquity || !day.Equal(g.day) {
+		g.day = day
+		g.dayEquity = equity
+		g.haveEquity = true
+	}
+	loss := g.dayEquity - equity
+	killed := g.killed
+	g.mu.Unlock()
+
+	if loss >= g.limits.MaxDailyLoss {
+		reason := fmt.Sprintf("lost %.2f NOK today, limit is %.2f", loss, g.limits.MaxDailyLoss)
+		if killed {
+			return fmt.Errorf("%w: %v", ErrDailyLoss, reason)
+		}
+		if err := g.kill(ctx, reason); err != nil {
+			return fmt.Errorf("%w: %v, and cancelling orders failed: %v", ErrDailyLoss, reason, err)
+		}
+		return fmt.Errorf("%w: %v", ErrDailyLoss, reason)
+	}
+	return nil
+}
+
+// equity values all balances in NOK at the mid price of their NOK market.
+// A held currency without a price is an error rather than worth nothing, as
+// a missing ticker must not look like a loss.
+func (g *Guard) equity(ctx context.Context) (float64, error) {
+	balances, err := g.PrivateAPI.GetBalancesV2(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tickers, err := g.PrivateAPI.GetMarketTickersV2(ctx)
+	if err != nil {
+		return 0, err
+	}
+	mid := map[string]float64{}
+	for _, t := range tickers {
+		if base := strings.TrimSuffix(t.MarketID, "NOK"); base != t.MarketID && t.Bid > 0 && t.Ask > 0 {
+			mid[base] = (t.Bid + t.Ask) / 2
+		}
+	}
+	total := 0.0
+	for _, b := range balances {
+		switch p, ok := mid[b.Currency]; {
+		case b.Currency == "NOK":
+			total += b.Balance
+		case b.Balance == 0:
+		case !ok:
+			return 0, fmt.Errorf("%w: %v", ErrNoPrice, b.Currency)
+		default:
+			total += b.Balance * p
+		}
+	}
+	return total, nil
+}
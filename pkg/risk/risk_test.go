@@ -0,0 +1,199 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/backtest"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var t0 = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func setBook(ex *backtest.Exchange, bid, ask float64) {
+	ex.Apply(backtest.Event{Time: t0, Market: firiclient.BTCNOK, Orderbook: &firiclient.Orderbook{
+		Bids: []firiclient.Order{{Price: bid, Quantity: 10}},
+		Asks: []firiclient.Order{{Price: ask, Quantity: 10}},
+	}})
+}
+
+func bid(price, amount float64) *firiclient.CreateOrderRequest {
+	return &firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Bid, Price: price, Amount: amount}
+}
+
+func TestOrderLimits(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 1})
+	setBook(ex, 99, 101)
+	g := New(ex, Limits{
+		Markets:       map[firiclient.MarketID]MarketLimits{firiclient.BTCNOK: {MaxAmount: 2, MaxNotional: 300}},
+		Default:       MarketLimits{MaxAmount: 5},
+		MaxOpenOrders: 2,
+		PriceBand:     0.05,
+	})
+
+	for _, c := range []struct {
+		r   *firiclient.CreateOrderRequest
+		err error
+	}{
+		{bid(99, 3), ErrMaxAmount},
+		{bid(99, 2), nil},
+		{bid(99, 3.5), ErrMaxAmount},
+		{bid(200, 1.6), ErrMaxNotional},
+		{bid(107, 1), ErrPriceBand},
+		{&firiclient.CreateOrderRequest{Market: "BTCNOK", Type: firiclient.Ask, Price: 94, Amount: 1}, ErrPriceBand},
+		{bid(98, 1), nil},
+		{bid(97, 1), ErrMaxOpenOrders},
+	} {
+		_, err := g.PostOrder(ctx, c.r)
+		if !errors.Is(err, c.err) {
+			t.Errorf("expected %v for %+v, got %v", c.err, *c.r, err)
+		}
+	}
+	if open, _ := ex.GetActiveOrders(ctx); len(open) != 2 {
+		t.Errorf("expected only accepted orders to reach the exchange, got %v", len(open))
+	}
+}
+
+func TestDailyLossKillSwitch(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 1})
+	setBook(ex, 99, 101)
+	g := New(ex, Limits{MaxDailyLoss: 50, Location: time.UTC})
+	g.nowFunc = func() time.Time { return t0 }
+
+	if _, err := g.PostOrder(ctx, bid(90, 1)); err != nil {
+		t.Fatalf("error posting order: %v", err)
+	}
+	// BTC falls from 100 to 41, a loss of 59
+	setBook(ex, 40, 42)
+	if _, err := g.PostOrder(ctx, bid(39, 1)); !errors.Is(err, ErrDailyLoss) {
+		t.Fatalf("expected ErrDailyLoss, got %v", err)
+	}
+	if killed, _ := g.Killed(); !killed {
+		t.Errorf("expected kill switch to be engaged")
+	}
+	if open, _ := ex.GetActiveOrders(ctx); len(open) != 0 {
+		t.Errorf("expected open orders to be cancelled, got %+v", open)
+	}
+	if _, err := g.PostOrder(ctx, bid(39, 1)); !errors.Is(err, ErrKilled) {
+		t.Errorf("expected ErrKilled, got %v", err)
+	}
+
+	// a new day starts from the current equity
+	g.Reset()
+	g.nowFunc = func() time.Time { return t0.Add(24 * time.Hour) }
+	if _, err := g.PostOrder(ctx, bid(39, 1)); err != nil {
+		t.Errorf("expected orders to be accepted the next day, got %v", err)
+	}
+}
+
+func TestKill(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000})
+	setBook(ex, 99, 101)
+	g := New(ex, Limits{})
+	g.PostOrder(ctx, bid(90, 1))
+
+	if err := g.Kill(ctx, "manual"); err != nil {
+		t.Fatalf("error killing: %v", err)
+	}
+	if open, _ := ex.GetActiveOrders(ctx); len(open) != 0 {
+		t.Errorf("expected open orders to be cancelled, got %+v", open)
+	}
+	if _, err := g.PostOrder(ctx, bid(90, 1)); !errors.Is(err, ErrKilled) {
+		t.Errorf("expected ErrKilled, got %v", err)
+	}
+}
+
+func TestConcurrentOrdersRespectMaxOpenOrders(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000})
+	setBook(ex, 99, 101)
+	g := New(ex, Limits{MaxOpenOrders: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.PostOrder(ctx, bid(90, 1))
+		}()
+	}
+	wg.Wait()
+	if open, _ := ex.GetActiveOrders(ctx); len(open) != 2 {
+		t.Errorf("expected 2 open orders, got %v", len(open))
+	}
+}
+
+// slowAPI blocks posts until released, to kill while an order is in flight.
+type slowAPI struct {
+	*backtest.Exchange
+	posting chan struct{}
+	release chan struct{}
+}
+
+func (s *slowAPI) PostOrder(ctx context.Context, r *firiclient.CreateOrderRequest) (*firiclient.CreateOrderResponse, error) {
+	close(s.posting)
+	<-s.release
+	return s.Exchange.PostOrder(ctx, r)
+}
+
+func TestKillCancelsOrderInFlight(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000})
+	setBook(ex, 99, 101)
+	api := &slowAPI{Exchange: ex, posting: make(chan struct{}), release: make(chan struct{})}
+	g := New(api, Limits{})
+
+	go g.PostOrder(ctx, bid(90, 1))
+	<-api.posting
+	killed := make(chan error)
+	go func() { killed <- g.Kill(ctx, "manual") }()
+	time.Sleep(10 * time.Millisecond)
+	close(api.release)
+	if err := <-killed; err != nil {
+		t.Fatalf("error killing: %v", err)
+	}
+	if open, _ := ex.GetActiveOrders(ctx); len(open) != 0 {
+		t.Errorf("expected the order in flight to be cancelled, got %+v", open)
+	}
+}
+
+func TestRunTripsKillSwitchWithoutOrders(t *testing.T) {
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "BTC": 1})
+	setBook(ex, 99, 101)
+	g := New(ex, Limits{MaxDailyLoss: 50, CheckInterval: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- g.Run(ctx) }()
+	// let Run snapshot the equity before the price falls
+	time.Sleep(20 * time.Millisecond)
+	setBook(ex, 40, 42)
+	for killed, _ := g.Killed(); !killed; killed, _ = g.Killed() {
+		if ctx.Err() != nil {
+			t.Fatalf("expected Run to engage the kill switch")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestMissingPriceIsNotALoss(t *testing.T) {
+	ctx := context.Background()
+	ex := backtest.NewExchange(backtest.FeeRates{}, map[string]float64{"NOK": 10_000, "ETH": 1})
+	setBook(ex, 99, 101)
+	g := New(ex, Limits{MaxDailyLoss: 50})
+	if _, err := g.PostOrder(ctx, bid(90, 1)); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("expected ErrNoPrice without an ETH ticker, got %v", err)
+	}
+	if killed, _ := g.Killed(); killed {
+		t.Errorf("expected no kill without a price")
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/esiqveland/firi/pkg/candles"
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var bucketCandles = []byte("candles")
+
+func candleBucketName(market firiclient.MarketID, interval time.Duration) []byte {
+	return []byte(string(market) + "/" + interval.String())
+}
+
+// PutCandles stores candles for a market and interval, replacing candles with the same start.
+func (d *DB) PutCandles(market firiclient.MarketID, interval time.Duration, cs []candles.Candle) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(bucketCandles)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists(candleBucketName(market, interval))
+		if err != nil {
+			return err
+		}
+		for _, c := range cs {
+			data, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(itob(c.Start.Unix()), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Candles returns the stored candles for a market and interval ordered by start.
+func (d *DB) Candles(market firiclient.MarketID, interval time.Duration) ([]candles.Candle, error) {
+	var res []candles.Candle
+	err := d.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(bucketCandles)
+		if root == nil {
+			return nil
+		}
+		b := root.Bucket(candleBucketName(market, interval))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			c := candles.Candle{}
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			res = append(res, c)
+			return nil
+		})
+	})
+	return res, err
+}
@@ -0,0 +1,238 @@
+// Package store keeps a local history of trades, orders and balances in an
+// embedded bolt database, so reports and analytics can run offline.
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+var (
+	bucketTrades   = []byte("trades")
+	bucketOrders   = []byte("orders")
+	bucketBalances = []byte("balances")
+)
+
+type DB struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketTrades, bucketOrders, bucketBalances} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// PutTrades stores trades not already present, keyed by trade id, and
+// returns the number of new trades.
+func (d *DB) PutTrades(trades firiclient.HistoricTrades) (int, error) {
+	added := 0
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketTrades)
+		for _, t := range trades {
+			n, err := putNew(b, []byte(t.Id), t)
+			if err != nil {
+				return err
+			}
+			added += n
+		}
+		return nil
+	})
+	return added, err
+}
+
+// Trades returns all stored trades ordered by date.
+func (d *DB) Trades() (firiclient.HistoricTrades, error) {
+	res := firiclient.HistoricTrades{}
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTrades).ForEach(func(k, v []byte) error {
+			t := firiclient.HistoricTrade{}
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			res = append(res, t)
+			return nil
+		})
+	})
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Date.Before(res[j].Date)
+	})
+	return res, err
+}
+
+// PutOrders stores filled and closed orders not already present, keyed by
+// order id, and returns the number of new orders.
+func (d *DB) PutOrders(orders firiclient.ActiveOrders) (int, error) {
+	added := 0
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketOrders)
+		for _, o := range orders {
+			n, err := putNew(b, itob(o.Id), o)
+			if err != nil {
+				return err
+			}
+			added += n
+		}
+		return nil
+	})
+	return added, err
+}
+
+// Orders returns all stored orders ordered by id.
+func (d *DB) Orders() (firiclient.ActiveOrders, error) {
+	res := firiclient.ActiveOrders{}
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketOrders).ForEach(func(k, v []byte) error {
+			o := firiclient.ActiveOrder{}
+			if err := json.Unmarshal(v, &o); err != nil {
+				return err
+			}
+			res = append(res, o)
+			return nil
+		})
+	})
+	return res, err
+}
+
+type BalanceSnapshot struct {
+	Time     time.Time           `json:"time"`
+	Balances firiclient.Balances `json:"balances"`
+}
+
+// PutBalances stores a snapshot of balances taken at ts, unless it is equal
+// to the latest stored snapshot. It reports whether a snapshot was written.
+func (d *DB) PutBalances(ts time.Time, balances firiclient.Balances) (bool, error) {
+	written := false
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketBalances)
+		data, err := json.Marshal(balances)
+		if err != nil {
+			return err
+		}
+		_, last := b.Cursor().Last()
+		if last != nil {
+			prev := BalanceSnapshot{}
+			if err := json.Unmarshal(last, &prev); err != nil {
+				return err
+			}
+			prevData, err := json.Marshal(prev.Balances)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(prevData, data) {
+				return nil
+			}
+		}
+		snap, err := json.Marshal(&BalanceSnapshot{Time: ts, Balances: balances})
+		if err != nil {
+			return err
+		}
+		written = true
+		return b.Put(itob(ts.UnixNano()), snap)
+	})
+	return written, err
+}
+
+// BalanceSnapshots returns all balance snapshots in the order they were taken.
+func (d *DB) BalanceSnapshots() ([]BalanceSnapshot, error) {
+	var res []BalanceSnapshot
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBalances).ForEach(func(k, v []byte) error {
+			s := BalanceSnapshot{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			res = append(res, s)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// Source is the part of the authenticated client used for syncing.
+type Source interface {
+	GetAllTrades(ctx context.Context) (firiclient.HistoricTrades, error)
+	GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error)
+	GetBalancesV2(ctx context.Context) (firiclient.Balances, error)
+}
+
+type SyncResult struct {
+	NewTrades   int
+	NewOrders   int
+	NewBalances bool
+}
+
+// Sync fetches trades, closed orders and balances from src and stores what
+// is not already in the database.
+func (d *DB) Sync(ctx context.Context, src Source) (*SyncResult, error) {
+	res := &SyncResult{}
+	trades, err := src.GetAllTrades(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.NewTrades, err = d.PutTrades(trades)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := src.GetAllFilledAndClosedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.NewOrders, err = d.PutOrders(orders)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := src.GetBalancesV2(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.NewBalances, err = d.PutBalances(time.Now(), balances)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func putNew(b *bolt.Bucket, key []byte, v interface{}) (int, error) {
+	if b.Get(key) != nil {
+		return 0, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return 1, b.Put(key, data)
+}
+
+func itob(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
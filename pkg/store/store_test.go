@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+type fakeSource struct {
+	trades   firiclient.HistoricTrades
+	orders   firiclient.ActiveOrders
+	balances firiclient.Balances
+}
+
+func (f *fakeSource) GetAllTrades(ctx context.Context) (firiclient.HistoricTrades, error) {
+	return f.trades, nil
+}
+
+func (f *fakeSource) GetAllFilledAndClosedOrders(ctx context.Context) (firiclient.ActiveOrders, error) {
+	return f.orders, nil
+}
+
+func (f *fakeSource) GetBalancesV2(ctx context.Context) (firiclient.Balances, error) {
+	return f.balances, nil
+}
+
+func TestSyncDeduplicates(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "firi.db"))
+	if err != nil {
+		t.Fatalf("error opening db: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	src := &fakeSource{
+		trades: firiclient.HistoricTrades{
+			{Id: "a", Market: "BTCNOK", Amount: 1, Date: now.Add(-time.Hour)},
+			{Id: "b", Market: "BTCNOK", Amount: 2, Date: now.Add(-2 * time.Hour)},
+		},
+		orders:   firiclient.ActiveOrders{{Id: 1, Market: "BTCNOK"}},
+		balances: firiclient.Balances{{Currency: "BTC", Balance: 1, Available: 1}},
+	}
+	ctx := context.Background()
+
+	res, err := db.Sync(ctx, src)
+	if err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if res.NewTrades != 2 || res.NewOrders != 1 || !res.NewBalances {
+		t.Errorf("unexpected first sync result=%+v", res)
+	}
+
+	src.trades = append(src.trades, firiclient.HistoricTrade{Id: "c", Market: "ETHNOK", Date: now})
+	res, err = db.Sync(ctx, src)
+	if err != nil {
+		t.Fatalf("error syncing: %v", err)
+	}
+	if res.NewTrades != 1 || res.NewOrders != 0 || res.NewBalances {
+		t.Errorf("unexpected second sync result=%+v", res)
+	}
+
+	trades, err := db.Trades()
+	if err != nil {
+		t.Fatalf("error reading trades: %v", err)
+	}
+	if len(trades) != 3 || trades[0].Id != "b" || trades[2].Id != "c" {
+		t.Errorf("unexpected trades=%+v", trades)
+	}
+	snaps, err := db.BalanceSnapshots()
+	if err != nil {
+		t.Fatalf("error reading balances: %v", err)
+	}
+	if len(snaps) != 1 {
+		t.Errorf("expected 1 balance snapshot, got %v", len(snaps))
+	}
+}
@@ -0,0 +1,63 @@
+package tax
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// WriteText writes a human readable report laid out like the virtual currency
+// schedule in the Norwegian tax return: holdings and wealth at year end, and
+// realised gains and losses per currency.
+func WriteText(w io.Writer, r *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, y := range r.Years {
+		fmt.Fprintf(tw, "Inntektsår %d\t\t\t\t\t\t\n", y.Year)
+		fmt.Fprintf(tw, "Valuta\tBeholdning\tKurs 31.12 (NOK)\tFormuesverdi (NOK)\tGevinst (NOK)\tTap (NOK)\t\n")
+		for _, c := range y.Currencies {
+			fmt.Fprintf(tw, "%v\t%v\t%.2f\t%.0f\t%.0f\t%.0f\t\n",
+				c.Currency, formatAmount(c.Amount), c.Price, c.Value, c.Gain, c.Loss)
+		}
+		fmt.Fprintf(tw, "Sum\t\t\t%.0f\t%.0f\t%.0f\t\n", y.Wealth, y.Gains, y.Losses)
+		fmt.Fprintf(tw, "Netto gevinst/tap\t\t\t\t%.0f\t\t\n\n", y.Net)
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes one row per year and currency.
+func WriteCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"year", "currency", "amount", "cost_basis", "price_nok", "value_nok", "gain_nok", "loss_nok"})
+	if err != nil {
+		return err
+	}
+	for _, y := range r.Years {
+		for _, c := range y.Currencies {
+			err := cw.Write([]string{
+				strconv.Itoa(y.Year),
+				c.Currency,
+				formatAmount(c.Amount),
+				formatNOK(c.CostBasis),
+				formatNOK(c.Price),
+				formatNOK(c.Value),
+				formatNOK(c.Gain),
+				formatNOK(c.Loss),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatNOK(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
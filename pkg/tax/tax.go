@@ -0,0 +1,314 @@
+// Package tax computes realised gains and year-end holdings from Firi trade
+// history, using FIFO cost basis per currency and NOK valuations at 31 December.
+package tax
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+const NOK = "NOK"
+
+// epsilon is the amount below which a lot is considered fully consumed.
+const epsilon = 1e-12
+
+var ErrInsufficientHoldings = errors.New("tax: sell exceeds holdings")
+var ErrUnsupportedCurrency = errors.New("tax: unsupported cost currency")
+
+// PriceSource returns the NOK price of one unit of a currency at a point in time.
+type PriceSource interface {
+	PriceNOK(ctx context.Context, currency string, at time.Time) (float64, error)
+}
+
+// YearEndPrices is a PriceSource backed by fixed prices per year and currency,
+// e.g. the official year-end rates published by Skatteetaten.
+type YearEndPrices map[int]map[string]float64
+
+func (p YearEndPrices) PriceNOK(ctx context.Context, currency string, at time.Time) (float64, error) {
+	price, ok := p[at.Year()][currency]
+	if !ok {
+		return 0, fmt.Errorf("tax: no year-end price for currency=%v year=%v", currency, at.Year())
+	}
+	return price, nil
+}
+
+// FeeFunc returns the fee in NOK paid for a trade.
+type FeeFunc func(t firiclient.HistoricTrade) float64
+
+func NoFees(t firiclient.HistoricTrade) float64 {
+	return 0
+}
+
+// Lot is a FIFO lot of a currency with its remaining amount and NOK cost basis.
+type Lot struct {
+	Currency string
+	Amount   float64
+	Cost     float64
+	Acquired time.Time
+	TradeID  string
+}
+
+// Disposal is a (part of a) sell matched against one acquired lot.
+type Disposal struct {
+	Currency  string
+	Amount    float64
+	Proceeds  float64
+	CostBasis float64
+	Gain      float64
+	Acquired  time.Time
+	Date      time.Time
+	TradeID   string
+}
+
+// CurrencySummary is the per-currency line of a year, as reported in the
+// virtual currency section of the Norwegian tax return.
+type CurrencySummary struct {
+	Currency  string
+	Amount    float64
+	CostBasis float64
+	Price     float64
+	Value     float64
+	Gain      float64
+	Loss      float64
+}
+
+type YearReport struct {
+	Year       int
+	Currencies []CurrencySummary
+	Disposals  []Disposal
+	Gains      float64
+	Losses     float64
+	Net        float64
+	Wealth     float64
+}
+
+type Report struct {
+	Years []YearReport
+}
+
+func (r *Report) Year(year int) (YearReport, bool) {
+	for _, y := range r.Years {
+		if y.Year == year {
+			return y, true
+		}
+	}
+	return YearReport{}, false
+}
+
+type Calculator struct {
+	Prices   PriceSource
+	Fee      FeeFunc
+	Location *time.Location
+}
+
+// NewCalculator returns a Calculator that values holdings using prices and
+// splits years in Europe/Oslo time, falling back to UTC if the zone database is missing.
+func NewCalculator(prices PriceSource) *Calculator {
+	loc, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		loc = time.UTC
+	}
+	return &Calculator{
+		Prices:   prices,
+		Fee:      NoFees,
+		Location: loc,
+	}
+}
+
+// Calculate runs FIFO over trades and reports every year from the first trade
+// up to and including the last one.
+func (c *Calculator) Calculate(ctx context.Context, trades firiclient.HistoricTrades) (*Report, error) {
+	if len(trades) == 0 {
+		return &Report{}, nil
+	}
+	first, last := trades[0].Date, trades[0].Date
+	for _, t := range trades {
+		if t.Date.Before(first) {
+			first = t.Date
+		}
+		if t.Date.After(last) {
+			last = t.Date
+		}
+	}
+	return c.CalculateYears(ctx, trades, first.In(c.Location).Year(), last.In(c.Location).Year())
+}
+
+// CalculateYears is like Calculate, but reports the years from..to inclusive.
+func (c *Calculator) CalculateYears(ctx context.Context, trades firiclient.HistoricTrades, from, to int) (*Report, error) {
+	sorted := make(firiclient.HistoricTrades, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Id < sorted[j].Id
+		}
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	ledger := newLedger()
+	report := &Report{}
+	next := 0
+	for year := from; year <= to; year++ {
+		yearEnd := time.Date(year+1, time.January, 1, 0, 0, 0, 0, c.Location)
+		var disposals []Disposal
+		for ; next < len(sorted) && sorted[next].Date.Before(yearEnd); next++ {
+			d, err := c.apply(ledger, sorted[next])
+			if err != nil {
+				return nil, err
+			}
+			if sorted[next].Date.In(c.Location).Year() >= from {
+				disposals = append(disposals, d...)
+			}
+		}
+		y, err := c.summarize(ctx, ledger, year, yearEnd.Add(-time.Second), disposals)
+		if err != nil {
+			return nil, err
+		}
+		report.Years = append(report.Years, y)
+	}
+	return report, nil
+}
+
+func (c *Calculator) apply(l *ledger, t firiclient.HistoricTrade) ([]Disposal, error) {
+	if t.CostCurrency != NOK {
+		return nil, fmt.Errorf("%w: trade=%v cost_currency=%v", ErrUnsupportedCurrency, t.Id, t.CostCurrency)
+	}
+	fee := 0.0
+	if c.Fee != nil {
+		fee = c.Fee(t)
+	}
+	switch firiclient.OrderType(t.Side) {
+	case firiclient.Bid:
+		l.buy(Lot{
+			Currency: t.AmountCurrency,
+			Amount:   t.Amount,
+			Cost:     t.Cost + fee,
+			Acquired: t.Date,
+			TradeID:  t.Id,
+		})
+		return nil, nil
+	case firiclient.Ask:
+		return l.sell(t, t.Cost-fee)
+	default:
+		return nil, fmt.Errorf("tax: unknown side=%v on trade=%v", t.Side, t.Id)
+	}
+}
+
+func (c *Calculator) summarize(ctx context.Context, l *ledger, year int, at time.Time, disposals []Disposal) (YearReport, error) {
+	y := YearReport{Year: year, Disposals: disposals}
+	byCurrency := map[string]*CurrencySummary{}
+	get := func(currency string) *CurrencySummary {
+		s, ok := byCurrency[currency]
+		if !ok {
+			s = &CurrencySummary{Currency: currency}
+			byCurrency[currency] = s
+		}
+		return s
+	}
+	// a sell spanning several lots is one realisation, so gain or loss is
+	// decided on the net of its disposals
+	type realisation struct {
+		currency string
+		gain     float64
+	}
+	var order []string
+	perTrade := map[string]*realisation{}
+	for _, d := range disposals {
+		r, ok := perTrade[d.TradeID]
+		if !ok {
+			r = &realisation{currency: d.Currency}
+			perTrade[d.TradeID] = r
+			order = append(order, d.TradeID)
+		}
+		r.gain += d.Gain
+	}
+	for _, id := range order {
+		r := perTrade[id]
+		s := get(r.currency)
+		if r.gain >= 0 {
+			s.Gain += r.gain
+		} else {
+			s.Loss += -r.gain
+		}
+	}
+	for currency, lots := range l.lots {
+		amount, cost := 0.0, 0.0
+		for _, lot := range lots {
+			amount += lot.Amount
+			cost += lot.Cost
+		}
+		if amount <= epsilon {
+			continue
+		}
+		price, err := c.Prices.PriceNOK(ctx, currency, at)
+		if err != nil {
+			return y, err
+		}
+		s := get(currency)
+		s.Amount = amount
+		s.CostBasis = cost
+		s.Price = price
+		s.Value = amount * price
+	}
+	for _, s := range byCurrency {
+		y.Currencies = append(y.Currencies, *s)
+		y.Gains += s.Gain
+		y.Losses += s.Loss
+		y.Wealth += s.Value
+	}
+	sort.Slice(y.Currencies, func(i, j int) bool {
+		return y.Currencies[i].Currency < y.Currencies[j].Currency
+	})
+	y.Net = y.Gains - y.Losses
+	return y, nil
+}
+
+type ledger struct {
+	lots map[string][]Lot
+}
+
+func newLedger() *ledger {
+	return &ledger{lots: map[string][]Lot{}}
+}
+
+func (l *ledger) buy(lot Lot) {
+	l.lots[lot.Currency] = append(l.lots[lot.Currency], lot)
+}
+
+func (l *ledger) sell(t firiclient.HistoricTrade, proceeds float64) ([]Disposal, error) {
+	lots := l.lots[t.AmountCurrency]
+	remaining := t.Amount
+	var out []Disposal
+	for remaining > epsilon {
+		if len(lots) == 0 {
+			return nil, fmt.Errorf("%w: trade=%v currency=%v missing=%v", ErrInsufficientHoldings, t.Id, t.AmountCurrency, remaining)
+		}
+		lot := &lots[0]
+		take := math.Min(lot.Amount, remaining)
+		basis := lot.Cost * take / lot.Amount
+		share := proceeds * take / t.Amount
+		out = append(out, Disposal{
+			Currency:  t.AmountCurrency,
+			Amount:    take,
+			Proceeds:  share,
+			CostBasis: basis,
+			Gain:      share - basis,
+			Acquired:  lot.Acquired,
+			Date:      t.Date,
+			TradeID:   t.Id,
+		})
+		lot.Amount -= take
+		lot.Cost -= basis
+		remaining -= take
+		if lot.Amount <= epsilon {
+			lots = lots[1:]
+		}
+	}
+	l.lots[t.AmountCurrency] = lots
+	return out, nil
+}
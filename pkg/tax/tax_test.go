@@ -0,0 +1,90 @@
+package tax
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/firi/pkg/firiclient"
+)
+
+func trade(id string, side firiclient.OrderType, date string, amount, cost float64) firiclient.HistoricTrade {
+	d, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		panic(err)
+	}
+	return firiclient.HistoricTrade{
+		Id:             id,
+		Market:         "BTCNOK",
+		Price:          cost / amount,
+		PriceCurrency:  NOK,
+		Amount:         amount,
+		AmountCurrency: "BTC",
+		Cost:           cost,
+		CostCurrency:   NOK,
+		Side:           string(side),
+		Date:           d,
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestFIFOGainsPerYear(t *testing.T) {
+	trades := firiclient.HistoricTrades{
+		trade("1", firiclient.Bid, "2021-02-01T10:00:00Z", 1, 100_000),
+		trade("2", firiclient.Bid, "2021-06-01T10:00:00Z", 1, 300_000),
+		// sells the whole first lot and half of the second
+		trade("3", firiclient.Ask, "2021-11-01T10:00:00Z", 1.5, 450_000),
+		trade("4", firiclient.Ask, "2022-03-01T10:00:00Z", 0.5, 100_000),
+	}
+	prices := YearEndPrices{
+		2021: {"BTC": 400_000},
+		2022: {"BTC": 150_000},
+	}
+	c := NewCalculator(prices)
+	c.Fee = func(t firiclient.HistoricTrade) float64 { return 100 }
+
+	r, err := c.Calculate(context.Background(), trades)
+	if err != nil {
+		t.Fatalf("error calculating: %v", err)
+	}
+	if len(r.Years) != 2 {
+		t.Fatalf("expected 2 years, got %v", len(r.Years))
+	}
+
+	y2021, _ := r.Year(2021)
+	// proceeds 449900, basis 100100 + 150050
+	if !almostEqual(y2021.Gains, 449_900-100_100-150_050) {
+		t.Errorf("unexpected gains 2021=%v", y2021.Gains)
+	}
+	if len(y2021.Currencies) != 1 || !almostEqual(y2021.Currencies[0].Amount, 0.5) {
+		t.Fatalf("unexpected holdings 2021=%+v", y2021.Currencies)
+	}
+	if !almostEqual(y2021.Wealth, 200_000) {
+		t.Errorf("unexpected wealth 2021=%v", y2021.Wealth)
+	}
+
+	y2022, _ := r.Year(2022)
+	// proceeds 99900, basis 150050
+	if !almostEqual(y2022.Losses, 150_050-99_900) || y2022.Gains != 0 {
+		t.Errorf("unexpected gains=%v losses=%v for 2022", y2022.Gains, y2022.Losses)
+	}
+	if y2022.Wealth != 0 {
+		t.Errorf("expected no holdings at end of 2022, got wealth=%v", y2022.Wealth)
+	}
+}
+
+func TestSellWithoutHoldings(t *testing.T) {
+	trades := firiclient.HistoricTrades{
+		trade("1", firiclient.Bid, "2021-02-01T10:00:00Z", 1, 100_000),
+		trade("2", firiclient.Ask, "2021-03-01T10:00:00Z", 2, 200_000),
+	}
+	_, err := NewCalculator(YearEndPrices{}).Calculate(context.Background(), trades)
+	if !errors.Is(err, ErrInsufficientHoldings) {
+		t.Errorf("expected ErrInsufficientHoldings, got %v", err)
+	}
+}